@@ -1,6 +1,6 @@
 module github.com/payports/golib/v3
 
-go 1.16
+go 1.18
 
 require (
 	github.com/snovichkov/zap-gelf v1.1.0
@@ -8,4 +8,14 @@ require (
 	github.com/teris-io/shortid v0.0.0-20201117134242-e59966efd125
 	go.elastic.co/ecszap v1.0.1
 	go.uber.org/zap v1.22.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/magefile/mage v1.9.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.9.0 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
 )
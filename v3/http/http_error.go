@@ -0,0 +1,30 @@
+package gl_http
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is returned when a response has a status code outside of the 2xx class.
+//
+// It can be extracted with errors.As to branch on the status or the error body of the upstream.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the raw response body.
+	Body []byte
+	// DecodeErr is the failure of unmarshaling Body, nil if it was unmarshaled or it was not attempted.
+	DecodeErr error
+}
+
+func (e *HTTPError) Error() string {
+	if e.DecodeErr != nil {
+		return fmt.Sprintf("unexpected response status: %d, could not unmarshal response body: %s", e.StatusCode, e.DecodeErr.Error())
+	}
+	return fmt.Sprintf("unexpected response status: %d", e.StatusCode)
+}
+
+// isSuccessStatus returns true for status codes of the 2xx class.
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
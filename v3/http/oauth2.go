@@ -0,0 +1,261 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenExpiryDelta is the default time before expiry at which cached tokens are refreshed.
+const DefaultTokenExpiryDelta = 10 * time.Second
+
+// DefaultTokenRequestTimeout is the default timeout of token requests.
+const DefaultTokenRequestTimeout = 30 * time.Second
+
+// ClientCredentialsConfig defines the token endpoint and credentials of an OAuth2 client (RFC 6749 section 4.4).
+type ClientCredentialsConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are additional form values of token requests, e.g. audience.
+	EndpointParams url.Values
+	// CredentialsInBody sends client credentials as form values instead of a basic auth header.
+	CredentialsInBody bool
+	// ExpiryDelta is the time before expiry at which tokens are refreshed, DefaultTokenExpiryDelta by default.
+	ExpiryDelta time.Duration
+	// RequestTimeout limits token requests, DefaultTokenRequestTimeout by default.
+	// Token requests are not bound to contexts of callers, since their result is shared.
+	RequestTimeout time.Duration
+	// HttpClient sends token requests. http.DefaultClient is used if it is nil.
+	HttpClient *http.Client
+}
+
+// ClientCredentialsTokenSource fetches access tokens with the client credentials grant and caches them until shortly before expiry.
+//
+// It is safe for concurrent use. When several callers need a new token at the same time, only one token request is sent.
+//
+// Tokens are attached to requests of WebRequestClient with its interceptor:
+//
+//	source, err := gl_http.NewClientCredentialsTokenSource(config)
+//	client := gl_http.NewWebRequestClient(httpCli, json.Marshal, json.Unmarshal, gl_http.WithInterceptors(source.Interceptor()))
+type ClientCredentialsTokenSource struct {
+	config ClientCredentialsConfig
+	client *WebRequestClient
+	now    func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	// In-flight token request, nil if there is none.
+	refresh *tokenRefresh
+}
+
+// tokenRefresh is a token request whose result is shared by every caller waiting for it.
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewClientCredentialsTokenSource creates a token source with input config.
+//
+// It will return error upon invalid data.
+func NewClientCredentialsTokenSource(config ClientCredentialsConfig) (*ClientCredentialsTokenSource, error) {
+	parsed, err := url.Parse(config.TokenURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("token URL must be absolute: '%s'", config.TokenURL)
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+
+	if config.ExpiryDelta <= 0 {
+		config.ExpiryDelta = DefaultTokenExpiryDelta
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = DefaultTokenRequestTimeout
+	}
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+
+	return &ClientCredentialsTokenSource{
+		config: config,
+		client: NewWebRequestClient(config.HttpClient, json.Marshal, json.Unmarshal),
+		now:    time.Now,
+	}, nil
+}
+
+// Token returns the cached access token, fetching a new one if it is missing or about to expire.
+//
+// Token requests run in the background, every caller waiting for one can give up with its own context.
+func (s *ClientCredentialsTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.token != "" && (s.expiry.IsZero() || s.now().Before(s.expiry)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	refresh := s.refresh
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		s.refresh = refresh
+		s.mu.Unlock()
+
+		go s.fetch(refresh)
+	} else {
+		s.mu.Unlock()
+	}
+
+	select {
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate drops input token from the cache, so that the next call of Token fetches a new one.
+// The cache is not changed if another token was fetched in the meantime.
+func (s *ClientCredentialsTokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+		s.expiry = time.Time{}
+	}
+}
+
+// fetch requests a token and shares the result with the callers waiting for refresh.
+func (s *ClientCredentialsTokenSource) fetch(refresh *tokenRefresh) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.RequestTimeout)
+	defer cancel()
+
+	token, expiresIn, err := s.requestToken(ctx)
+
+	s.mu.Lock()
+	if err == nil {
+		s.token = token
+		s.expiry = time.Time{}
+		if expiresIn > 0 {
+			// Short-lived tokens are refreshed at half of their lifetime, so that they are still cached.
+			delta := s.config.ExpiryDelta
+			if delta > expiresIn/2 {
+				delta = expiresIn / 2
+			}
+			s.expiry = s.now().Add(expiresIn - delta)
+		}
+	}
+	s.refresh = nil
+	s.mu.Unlock()
+
+	refresh.token, refresh.err = token, err
+	close(refresh.done)
+}
+
+// requestToken sends a client credentials token request and returns the access token with its lifetime.
+// Lifetime is zero if the token endpoint did not define it.
+func (s *ClientCredentialsTokenSource) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	for k, v := range s.config.EndpointParams {
+		form[k] = append([]string(nil), v...)
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	var errBody tokenErrorResponse
+	req := s.client.NewRequest(http.MethodPost, s.config.TokenURL).
+		WithHeader("Content-Type", "application/x-www-form-urlencoded").
+		WithHeader("Accept", "application/json").
+		WithErrorBody(&errBody)
+
+	if s.config.CredentialsInBody {
+		form.Set("client_id", s.config.ClientID)
+		form.Set("client_secret", s.config.ClientSecret)
+	} else {
+		// RFC 6749 section 2.3.1 requires credentials to be form encoded before basic auth encoding.
+		req.WithHeader("Authorization", basicAuthHeaderValue(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret)))
+	}
+	req.WithRawBody([]byte(form.Encode()))
+
+	res, err := Do[tokenResponse](ctx, req)
+	if err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && errBody.Error != "" {
+			return "", 0, fmt.Errorf("token request failed with status: %d error: %s %s", httpErr.StatusCode, errBody.Error, errBody.ErrorDescription)
+		}
+		return "", 0, fmt.Errorf("token request failed: %s", err.Error())
+	}
+
+	if res.Data.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response has no access token")
+	}
+	if res.Data.TokenType != "" && !strings.EqualFold(res.Data.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type: '%s'", res.Data.TokenType)
+	}
+	return res.Data.AccessToken, time.Duration(res.Data.ExpiresIn) * time.Second, nil
+}
+
+// Interceptor sets 'Authorization: Bearer <token>' on requests of WebRequestClient.
+//
+// When a request is answered with 401, the token is invalidated and the request is sent once more with a new token.
+// Requests whose body can not be rewound are not sent again.
+func (s *ClientCredentialsTokenSource) Interceptor() Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		token, err := s.Token(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("could not get bearer token: %s", err.Error())
+		}
+
+		retryReq := req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := next(req)
+		if err != nil || res.StatusCode != http.StatusUnauthorized {
+			return res, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return res, nil
+		}
+
+		s.Invalidate(token)
+		token, err = s.Token(req.Context())
+		if err != nil {
+			// Caller receives the 401 response, since the new token was not available.
+			return res, nil
+		}
+
+		if req.GetBody != nil {
+			retryReq.Body, err = req.GetBody()
+			if err != nil {
+				return res, nil
+			}
+		}
+		res.Body.Close()
+
+		retryReq.Header.Set("Authorization", "Bearer "+token)
+		return next(retryReq)
+	}
+}
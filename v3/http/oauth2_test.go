@@ -0,0 +1,170 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer issues tokens named token-<n>, which expire after expiresIn seconds.
+func newTokenServer(t *testing.T, expiresIn int, issued *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Credentials are form encoded before basic auth encoding (RFC 6749 section 2.3.1).
+		clientID, clientSecret, ok := r.BasicAuth()
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		if !ok || clientID != "client" || clientSecret != "s3cr%t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"unknown client"}`))
+			return
+		}
+
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "payments refunds", r.PostForm.Get("scope"))
+		assert.Equal(t, "psp", r.PostForm.Get("audience"))
+
+		// Concurrent callers wait for the same token request.
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+}
+
+func newTestTokenSource(t *testing.T, tokenURL, clientSecret string) *ClientCredentialsTokenSource {
+	source, err := NewClientCredentialsTokenSource(ClientCredentialsConfig{
+		TokenURL:       tokenURL,
+		ClientID:       "client",
+		ClientSecret:   clientSecret,
+		Scopes:         []string{"payments", "refunds"},
+		EndpointParams: map[string][]string{"audience": {"psp"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func Test_Client_Credentials_Token_Source(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+	defer tokenServer.Close()
+
+	source := newTestTokenSource(t, tokenServer.URL, "s3cr%t")
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = source.Token(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+
+	// Tokens are refreshed shortly before they expire.
+	source.now = func() time.Time {
+		return time.Now().Add(3600*time.Second - DefaultTokenExpiryDelta)
+	}
+	token, err := source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+
+	// Only the current token is invalidated.
+	source.Invalidate("token-1")
+	token, _ = source.Token(context.Background())
+	assert.Equal(t, "token-2", token)
+
+	// Token request started by a caller which gives up is completed for the other callers.
+	source.Invalidate("token-2")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = source.Token(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	token, err = source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-3", token)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&issued))
+
+	_, err = NewClientCredentialsTokenSource(ClientCredentialsConfig{TokenURL: "/token", ClientID: "client"})
+	assert.EqualError(t, err, "token URL must be absolute: '/token'")
+
+	source = newTestTokenSource(t, tokenServer.URL, "wrong")
+	_, err = source.Token(context.Background())
+	assert.EqualError(t, err, "token request failed with status: 401 error: invalid_client unknown client")
+}
+
+func Test_Client_Credentials_Short_Lived_Token(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 4, &issued)
+	defer tokenServer.Close()
+
+	source := newTestTokenSource(t, tokenServer.URL, "s3cr%t")
+	now := time.Now()
+	source.now = func() time.Time {
+		return now
+	}
+
+	// Token lives shorter than the expiry delta, it is cached for half of its lifetime.
+	for i := 0; i < 2; i++ {
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+
+	now = now.Add(2 * time.Second)
+	token, err := source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func Test_Client_Credentials_Interceptor(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+	defer tokenServer.Close()
+
+	// Upstream accepts only the latest token, as if older ones were revoked.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&issued)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	source := newTestTokenSource(t, tokenServer.URL, "s3cr%t")
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithInterceptors(source.Interceptor()))
+
+	res, err := Do[testBranch](context.Background(), client.NewRequest(http.MethodPost, server.URL).WithBody(testBranch{Code: "1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "1"}, res.Data)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+
+	// Token is revoked, request is sent again with a new token.
+	atomic.AddInt32(&issued, 1)
+	res, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodPost, server.URL).WithBody(testBranch{Code: "2"}))
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "2"}, res.Data)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&issued))
+	token, _ := source.Token(context.Background())
+	assert.Equal(t, "token-3", token)
+}
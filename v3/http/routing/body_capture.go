@@ -0,0 +1,57 @@
+package gl_routing
+
+import (
+	"bytes"
+	"io"
+)
+
+// cappedBuffer collects at most limit bytes written to it and silently drops the rest.
+//
+// It never fails a write, so it can be used as the destination of a tee without affecting the streamed data.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+// Bytes returns captured data.
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Truncated returns true if more data was written than the limit.
+func (b *cappedBuffer) Truncated() bool {
+	return b.truncated
+}
+
+// teeReadCloser writes everything read from the wrapped ReadCloser to w.
+type teeReadCloser struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
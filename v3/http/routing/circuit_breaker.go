@@ -0,0 +1,200 @@
+package gl_routing
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests to an upstream whose circuit breaker is open.
+// ProxyClient answers them with 503.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until OpenDuration passes.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of trial requests through.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerConfig defines when circuit breakers of ProxyClient upstreams open and close.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit.
+	// Connection errors, timeouts and 502, 503, 504 responses are failures.
+	FailureThreshold int
+	// OpenDuration is the time after which an open circuit becomes half-open.
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of trial requests let through while half-open.
+	// The circuit closes once all of them succeed and opens again on the first failure.
+	HalfOpenRequests int
+
+	// OnStateChange receives state transitions of every circuit breaker.
+	// If it is nil, transitions are reported through onErr hook of ProxyClient with an empty session ID.
+	OnStateChange func(event *CircuitBreakerEvent)
+}
+
+// CircuitBreakerEvent is a state transition of the circuit breaker of an upstream.
+type CircuitBreakerEvent struct {
+	Upstream string
+	From     CircuitState
+	To       CircuitState
+}
+
+func (e *CircuitBreakerEvent) Error() string {
+	return fmt.Sprintf("circuit breaker of upstream: '%s' changed from %s to %s", e.Upstream, e.From, e.To)
+}
+
+// circuitBreakers holds a circuit breaker for each upstream.
+type circuitBreakers struct {
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(config CircuitBreakerConfig) *circuitBreakers {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.HalfOpenRequests < 1 {
+		config.HalfOpenRequests = 1
+	}
+
+	return &circuitBreakers{config: config, breakers: make(map[string]*circuitBreaker)}
+}
+
+// get returns the circuit breaker of input upstream, creating it if necessary.
+func (b *circuitBreakers) get(upstream string) *circuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker, ok := b.breakers[upstream]
+	if !ok {
+		breaker = &circuitBreaker{upstream: upstream, config: &b.config}
+		b.breakers[upstream] = breaker
+	}
+	return breaker
+}
+
+// state returns the current state of input upstream's circuit breaker.
+func (b *circuitBreakers) state(upstream string) CircuitState {
+	breaker := b.get(upstream)
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+type circuitBreaker struct {
+	upstream string
+	config   *CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// Trial requests let through while half-open.
+	trials int
+	// Trial requests succeeded while half-open.
+	successes int
+}
+
+// allow returns true if a request can be sent to the upstream.
+// Every allowed request must be followed by a call to record or abandon.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	var event *CircuitBreakerEvent
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.config.OpenDuration {
+		event = cb.transition(CircuitHalfOpen)
+	}
+
+	allowed := true
+	switch cb.state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		allowed = cb.trials < cb.config.HalfOpenRequests
+		if allowed {
+			cb.trials++
+		}
+	}
+	cb.mu.Unlock()
+
+	cb.report(event)
+	return allowed
+}
+
+// record updates the state with the outcome of an allowed request.
+func (cb *circuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	var event *CircuitBreakerEvent
+
+	switch cb.state {
+	case CircuitClosed:
+		if success {
+			cb.failures = 0
+		} else if cb.failures++; cb.failures >= cb.config.FailureThreshold {
+			event = cb.transition(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !success {
+			event = cb.transition(CircuitOpen)
+		} else if cb.successes++; cb.successes >= cb.config.HalfOpenRequests {
+			event = cb.transition(CircuitClosed)
+		}
+	}
+	cb.mu.Unlock()
+
+	cb.report(event)
+}
+
+// abandon gives back an allowed request whose outcome says nothing about the upstream.
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen && cb.trials > 0 {
+		cb.trials--
+	}
+}
+
+// transition changes the state and resets counters. Must be called while holding mu.
+func (cb *circuitBreaker) transition(to CircuitState) *CircuitBreakerEvent {
+	event := &CircuitBreakerEvent{Upstream: cb.upstream, From: cb.state, To: to}
+
+	cb.state = to
+	cb.failures = 0
+	cb.trials = 0
+	cb.successes = 0
+	if to == CircuitOpen {
+		cb.openedAt = time.Now()
+	}
+	return event
+}
+
+func (cb *circuitBreaker) report(event *CircuitBreakerEvent) {
+	if event != nil && cb.config.OnStateChange != nil {
+		cb.config.OnStateChange(event)
+	}
+}
@@ -0,0 +1,63 @@
+package gl_routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Circuit_Breaker_Transitions(t *testing.T) {
+	var events []string
+	breakers := newCircuitBreakers(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenDuration:     20 * time.Millisecond,
+		HalfOpenRequests: 2,
+		OnStateChange: func(event *CircuitBreakerEvent) {
+			events = append(events, event.From.String()+">"+event.To.String())
+		},
+	})
+	cb := breakers.get("http://payments")
+
+	assert.True(t, cb.allow())
+	cb.record(false)
+	assert.True(t, cb.allow())
+	cb.record(true)
+	assert.Equal(t, CircuitClosed, breakers.state("http://payments"))
+
+	// Consecutive failures open the circuit.
+	for i := 0; i < 2; i++ {
+		assert.True(t, cb.allow())
+		cb.record(false)
+	}
+	assert.Equal(t, CircuitOpen, breakers.state("http://payments"))
+	assert.False(t, cb.allow())
+
+	// Failed trial opens the circuit again.
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, cb.allow())
+	assert.Equal(t, CircuitHalfOpen, breakers.state("http://payments"))
+	cb.record(false)
+	assert.False(t, cb.allow())
+
+	// Only HalfOpenRequests trials are let through, all of them must succeed.
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, cb.allow())
+	assert.True(t, cb.allow())
+	assert.False(t, cb.allow())
+	cb.record(true)
+	assert.Equal(t, CircuitHalfOpen, breakers.state("http://payments"))
+	cb.record(true)
+	assert.Equal(t, CircuitClosed, breakers.state("http://payments"))
+
+	// Other upstreams are not affected.
+	assert.Equal(t, CircuitClosed, breakers.state("http://accounts"))
+
+	assert.Equal(t, []string{
+		"closed>open",
+		"open>half-open",
+		"half-open>open",
+		"open>half-open",
+		"half-open>closed",
+	}, events)
+}
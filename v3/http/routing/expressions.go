@@ -1,50 +1,198 @@
 package gl_routing
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 )
 
+const (
+	segmentRegex  = `[^/]+`
+	catchAllRegex = `.+`
+	// Legacy route parameter regex which is still accepted by RegToRouteExp.
+	legacySegmentRegex = `\S+`
+)
+
+// routeConstraints contains named route parameter constraints as key: name, value: regex pairs.
+var routeConstraints = map[string]string{
+	"int":   `[0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+}
+
+// routeParamDef is a parsed curly bracket route parameter definition.
+type routeParamDef struct {
+	name string
+	// Regex constraint of the parameter. Empty if there is none.
+	constraint string
+	catchAll   bool
+}
+
+// regex returns the regular expression which route parameter values must match.
+func (d routeParamDef) regex() string {
+	if d.catchAll {
+		return catchAllRegex
+	}
+	if d.constraint == "" {
+		return segmentRegex
+	}
+	if named, ok := routeConstraints[d.constraint]; ok {
+		return named
+	}
+	return d.constraint
+}
+
+// parseRouteParamDef parses body of a curly bracket definition.
+//
+// E.g.: 'id', 'id:int', 'slug:[a-z-]+' or 'path...'.
+func parseRouteParamDef(body string) (routeParamDef, error) {
+	def := routeParamDef{name: body}
+
+	if sep := strings.IndexByte(body, ':'); sep >= 0 {
+		def.name = body[:sep]
+		def.constraint = body[sep+1:]
+		if def.constraint == "" {
+			return def, fmt.Errorf("empty constraint for route parameter: '%s'", def.name)
+		}
+	} else if strings.HasSuffix(body, "...") {
+		def.name = strings.TrimSuffix(body, "...")
+		def.catchAll = true
+	}
+
+	if !isRouteParamName(def.name) {
+		return def, fmt.Errorf("invalid route parameter name: '%s'", def.name)
+	}
+
+	if def.constraint != "" {
+		_, err := regexp.Compile(def.regex())
+		if err != nil {
+			return def, fmt.Errorf("invalid constraint for route parameter: '%s' error: %s", def.name, err.Error())
+		}
+	}
+	return def, nil
+}
+
+// findRouteParamEnd returns index of the curly bracket which closes the definition starting at start.
+// Nested curly brackets of regex constraints (e.g. '{code:[0-9]{4}}') are taken into account.
+func findRouteParamEnd(routeex string, start int) int {
+	depth := 0
+	for i := start; i < len(routeex); i++ {
+		switch routeex[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 // RegToRouteExp converts regular expression to route expression format.
 //
-// E.g.: '(?P<guid>\S+)' will convert to '{guid}'.
+// E.g.: '(?P<guid>[^/]+)' will convert to '{guid}', '(?P<id>[0-9]+)' will convert to '{id:int}'
+// and '(?P<path>.+)' will convert to '{path...}'.
+//
+// Named groups with other expressions are converted to inline constraints, e.g. '{slug:[a-z-]+}'.
 func RegToRouteExp(regex string) (string, error) {
-	compiledReg, err := regexp.Compile(`((?:\(\?P<\w+\>\\S\+\))+),?`)
-	if err != nil {
-		return "", err
+	routeex := strings.Builder{}
+
+	for i := 0; i < len(regex); i++ {
+		if !strings.HasPrefix(regex[i:], `(?P<`) {
+			routeex.WriteByte(regex[i])
+			continue
+		}
+
+		nameEnd := strings.IndexByte(regex[i:], '>')
+		if nameEnd < 0 {
+			return "", fmt.Errorf("unclosed group name at index %d", i)
+		}
+		nameEnd += i
+
+		end := findGroupEnd(regex, i)
+		if end < 0 {
+			return "", fmt.Errorf("unclosed group at index %d", i)
+		}
+
+		name := regex[i+len(`(?P<`) : nameEnd]
+		expr := regex[nameEnd+1 : end]
+
+		routeex.WriteString("{" + name + routeConstraintSuffix(expr) + "}")
+		i = end
 	}
 
-	matches := compiledReg.FindAllString(regex, -1)
-	routeex := regex
+	return routeex.String(), nil
+}
 
-	for _, m := range matches {
-		modified := strings.Replace(m, `(?P<`, `{`, 1)
-		modified = strings.Replace(modified, `>\S+)`, `}`, 1)
+func routeConstraintSuffix(expr string) string {
+	switch expr {
+	case segmentRegex, legacySegmentRegex:
+		return ""
+	case catchAllRegex:
+		return "..."
+	}
 
-		routeex = strings.Replace(routeex, m, modified, 1)
+	for name, constraint := range routeConstraints {
+		if constraint == expr {
+			return ":" + name
+		}
 	}
+	return ":" + expr
+}
 
-	return routeex, nil
+// findGroupEnd returns index of the parenthesis which closes the group starting at start.
+func findGroupEnd(regex string, start int) int {
+	depth := 0
+	for i := start; i < len(regex); i++ {
+		switch regex[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
 }
 
 // RouteToRegExp converts route expression to regular expression format.
 //
-// E.g.: '{guid}' will convert to '(?P<guid>\S+)'.
+// E.g.: '{guid}' will convert to '(?P<guid>[^/]+)'.
+//
+// Route parameters can be constrained with a named constraint (int, uuid, alpha, alnum) or an inline regex,
+// e.g. '{id:int}' will convert to '(?P<id>[0-9]+)' and '{slug:[a-z-]+}' will convert to '(?P<slug>[a-z-]+)'.
+//
+// A trailing ellipsis defines a catch-all parameter which can also match slashes,
+// e.g. '{path...}' will convert to '(?P<path>.+)'.
 func RouteToRegExp(routeex string) (string, error) {
-	compiledReg, err := regexp.Compile(`((?:\{\w+\})+),?`)
-	if err != nil {
-		return "", err
-	}
+	regex := strings.Builder{}
+
+	for i := 0; i < len(routeex); i++ {
+		if routeex[i] != '{' {
+			regex.WriteByte(routeex[i])
+			continue
+		}
 
-	matches := compiledReg.FindAllString(routeex, -1)
-	regex := routeex
+		end := findRouteParamEnd(routeex, i)
+		if end < 0 {
+			return "", fmt.Errorf("unclosed route parameter at index %d", i)
+		}
 
-	for _, m := range matches {
-		modified := strings.Replace(m, `{`, `(?P<`, 1)
-		modified = strings.Replace(modified, `}`, `>\S+)`, 1)
+		def, err := parseRouteParamDef(routeex[i+1 : end])
+		if err != nil {
+			return "", err
+		}
 
-		regex = strings.Replace(regex, m, modified, 1)
+		regex.WriteString(`(?P<` + def.name + `>` + def.regex() + `)`)
+		i = end
 	}
 
-	return regex, nil
+	return regex.String(), nil
 }
@@ -14,21 +14,37 @@ func TestRegExRouteExConversions(t *testing.T) {
 
 	testData := []testStruct{
 		{
-			regex:   `(?P<guid>\S+)`,
+			regex:   `(?P<guid>[^/]+)`,
 			routeex: `{guid}`,
 		},
 		{
-			regex:   `abc/(?P<guid>\S+)/abc`,
+			regex:   `abc/(?P<guid>[^/]+)/abc`,
 			routeex: `abc/{guid}/abc`,
 		},
 		{
-			regex:   `abc/(?P<param1>\S+)/abcd/(?P<param2>\S+)`,
+			regex:   `abc/(?P<param1>[^/]+)/abcd/(?P<param2>[^/]+)`,
 			routeex: `abc/{param1}/abcd/{param2}`,
 		},
 		{
-			regex:   `/api/transfers/(?P<id>\S+)/something/(?P<ref>\S+)`,
+			regex:   `/api/transfers/(?P<id>[^/]+)/something/(?P<ref>[^/]+)`,
 			routeex: `/api/transfers/{id}/something/{ref}`,
 		},
+		{
+			regex:   `/api/entity/(?P<id>[0-9]+)`,
+			routeex: `/api/entity/{id:int}`,
+		},
+		{
+			regex:   `/api/transfers/(?P<guid>[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})`,
+			routeex: `/api/transfers/{guid:uuid}`,
+		},
+		{
+			regex:   `/blog/(?P<slug>[a-z-]+)/(?P<code>[0-9]{4})`,
+			routeex: `/blog/{slug:[a-z-]+}/{code:[0-9]{4}}`,
+		},
+		{
+			regex:   `/static/(?P<path>.+)`,
+			routeex: `/static/{path...}`,
+		},
 	}
 
 	// Route expression to regular expression conversions.
@@ -47,3 +63,24 @@ func TestRegExRouteExConversions(t *testing.T) {
 		assert.Equal(t, td.routeex, routeEx)
 	}
 }
+
+func TestLegacyRegExToRouteEx(t *testing.T) {
+	routeEx, err := RegToRouteExp(`abc/(?P<guid>\S+)/abc`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `abc/{guid}/abc`, routeEx)
+}
+
+func TestInvalidRouteEx(t *testing.T) {
+	invalid := []string{
+		`/api/{id`,
+		`/api/{id:}`,
+		`/api/{id:[0-9}`,
+		`/api/{i-d}`,
+	}
+
+	for _, routeex := range invalid {
+		_, err := RouteToRegExp(routeex)
+		assert.Error(t, err, routeex)
+	}
+}
@@ -0,0 +1,230 @@
+package gl_routing
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are removed by proxies as defined in RFC 7230 section 6.1.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HeaderPolicy defines which headers ProxyClient passes between client and upstream.
+//
+// Hop-by-hop headers are always removed.
+// Header names are case-insensitive and can end with '*' to match a prefix, e.g. 'X-Internal-*'.
+type HeaderPolicy struct {
+	// RequestAllowList restricts forwarded request headers to the listed ones when it is not empty.
+	RequestAllowList []string
+	// RequestDenyList headers are never forwarded to upstream.
+	RequestDenyList []string
+	// ResponseAllowList restricts returned response headers to the listed ones when it is not empty.
+	ResponseAllowList []string
+	// ResponseDenyList headers are never returned to the client, e.g. 'Server' or 'X-Powered-By'.
+	ResponseDenyList []string
+
+	// TrustForwardedHeaders keeps X-Forwarded-* and Forwarded headers sent by the client and appends to them.
+	// Otherwise they are replaced, since clients can spoof them.
+	TrustForwardedHeaders bool
+	// DisableForwardedHeaders disables adding X-Forwarded-* and Forwarded headers.
+	// Headers sent by the client are passed, although httputil.ReverseProxy still appends the client IP
+	// to an existing X-Forwarded-For header.
+	DisableForwardedHeaders bool
+}
+
+// headerMatcher matches canonical header names against exact names and prefixes.
+type headerMatcher struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+func newHeaderMatcher(names []string) *headerMatcher {
+	if len(names) == 0 {
+		return nil
+	}
+
+	m := &headerMatcher{exact: make(map[string]bool, len(names))}
+	for _, name := range names {
+		if strings.HasSuffix(name, "*") {
+			m.prefixes = append(m.prefixes, strings.ToLower(strings.TrimSuffix(name, "*")))
+			continue
+		}
+		m.exact[http.CanonicalHeaderKey(name)] = true
+	}
+	return m
+}
+
+func (m *headerMatcher) matches(name string) bool {
+	if m.exact[name] {
+		return true
+	}
+
+	lower := strings.ToLower(name)
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compiledHeaderPolicy is the prepared form of HeaderPolicy used while handling requests.
+type compiledHeaderPolicy struct {
+	policy HeaderPolicy
+
+	requestAllow  *headerMatcher
+	requestDeny   *headerMatcher
+	responseAllow *headerMatcher
+	responseDeny  *headerMatcher
+}
+
+func compileHeaderPolicy(policy HeaderPolicy) *compiledHeaderPolicy {
+	return &compiledHeaderPolicy{
+		policy:        policy,
+		requestAllow:  newHeaderMatcher(policy.RequestAllowList),
+		requestDeny:   newHeaderMatcher(policy.RequestDenyList),
+		responseAllow: newHeaderMatcher(policy.ResponseAllowList),
+		responseDeny:  newHeaderMatcher(policy.ResponseDenyList),
+	}
+}
+
+// applyToRequest prepares headers of the outgoing copy of the client request.
+func (p *compiledHeaderPolicy) applyToRequest(req *http.Request) {
+	upgrade := upgradeType(req.Header)
+
+	removeHopByHopHeaders(req.Header)
+	filterHeaders(req.Header, p.requestAllow, p.requestDeny)
+
+	if upgrade != "" {
+		// Upgrade requests keep the headers which are required for the protocol switch.
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgrade)
+	}
+
+	if p.policy.DisableForwardedHeaders {
+		if _, ok := req.Header["X-Forwarded-For"]; !ok {
+			// A nil value prevents httputil.ReverseProxy from adding the header.
+			req.Header["X-Forwarded-For"] = nil
+		}
+		return
+	}
+	p.setForwardedHeaders(req)
+}
+
+// applyToResponse removes hop-by-hop and filtered headers from the upstream response.
+func (p *compiledHeaderPolicy) applyToResponse(res *http.Response) {
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		removeHopByHopHeaders(res.Header)
+		filterHeaders(res.Header, p.responseAllow, p.responseDeny)
+		return
+	}
+
+	upgrade := upgradeType(res.Header)
+	filterHeaders(res.Header, p.responseAllow, p.responseDeny)
+
+	if upgrade != "" {
+		// httputil.ReverseProxy rejects switching responses without the headers of the protocol switch.
+		res.Header.Set("Connection", "Upgrade")
+		res.Header.Set("Upgrade", upgrade)
+	}
+}
+
+// setForwardedHeaders adds X-Forwarded-* and Forwarded headers describing the client connection of req.
+func (p *compiledHeaderPolicy) setForwardedHeaders(req *http.Request) {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	if !p.policy.TrustForwardedHeaders {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("X-Forwarded-Proto")
+		req.Header.Del("X-Forwarded-Host")
+		req.Header.Del("Forwarded")
+	}
+
+	// X-Forwarded-For is appended with the client IP by httputil.ReverseProxy.
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	element := "proto=" + proto
+	if req.Host != "" {
+		element = "host=" + quoteForwardedValue(req.Host) + ";" + element
+	}
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		element = "for=" + forwardedNode(clientIP) + ";" + element
+	}
+
+	if prior := req.Header.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	req.Header.Set("Forwarded", element)
+}
+
+// forwardedNode formats an IP address as a node of Forwarded header as defined in RFC 7239.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quoteForwardedValue(value string) string {
+	if strings.ContainsAny(value, ":[]") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// removeHopByHopHeaders removes headers defined in RFC 7230 section 6.1, including the ones listed in Connection header.
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+func filterHeaders(header http.Header, allow, deny *headerMatcher) {
+	for name := range header {
+		if allow != nil && !allow.matches(name) {
+			header.Del(name)
+			continue
+		}
+		if deny != nil && deny.matches(name) {
+			header.Del(name)
+		}
+	}
+}
+
+// upgradeType returns the protocol requested with Upgrade header or an empty string if it is not an upgrade request.
+func upgradeType(header http.Header) string {
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return header.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package gl_routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Header_Policy(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Server", "upstream/1.0")
+		w.Header().Set("X-Powered-By", "go")
+		w.Header().Set("X-Request-Id", "abc")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	send := func(pc *ProxyClient) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(`GET`, `http://gateway.local/api/accounts`, nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		req.Header.Set("Connection", "keep-alive, X-Debug")
+		req.Header.Set("X-Debug", "1")
+		req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+		req.Header.Set("X-Internal-Token", "secret")
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("Forwarded", "for=10.0.0.1")
+		req.Header.Set("Accept", "application/json")
+
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+		return rec
+	}
+
+	rules := []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)}
+
+	t.Run("default", func(t *testing.T) {
+		rec := send(newTestProxyClient(t, rules, upstream.URL, nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, received.Get("X-Debug"))
+		assert.Empty(t, received.Get("Proxy-Authorization"))
+		assert.Equal(t, "secret", received.Get("X-Internal-Token"))
+		assert.Equal(t, "203.0.113.7", received.Get("X-Forwarded-For"))
+		assert.Equal(t, "http", received.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "gateway.local", received.Get("X-Forwarded-Host"))
+		assert.Equal(t, "for=203.0.113.7;host=gateway.local;proto=http", received.Get("Forwarded"))
+
+		assert.Equal(t, "upstream/1.0", rec.Header().Get("Server"))
+		assert.Empty(t, rec.Header().Get("Keep-Alive"))
+	})
+
+	t.Run("trusted forwarded headers", func(t *testing.T) {
+		pc := newTestProxyClient(t, rules, upstream.URL, nil)
+		pc.SetHeaderPolicy(HeaderPolicy{TrustForwardedHeaders: true})
+		send(pc)
+
+		assert.Equal(t, "10.0.0.1, 203.0.113.7", received.Get("X-Forwarded-For"))
+		assert.Equal(t, "for=10.0.0.1, for=203.0.113.7;host=gateway.local;proto=http", received.Get("Forwarded"))
+	})
+
+	t.Run("disabled forwarded headers", func(t *testing.T) {
+		pc := newTestProxyClient(t, rules, upstream.URL, nil)
+		pc.SetHeaderPolicy(HeaderPolicy{DisableForwardedHeaders: true})
+		send(pc)
+
+		assert.Empty(t, received.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "for=10.0.0.1", received.Get("Forwarded"))
+
+		pc.SetHeaderPolicy(HeaderPolicy{DisableForwardedHeaders: true, RequestDenyList: []string{"X-Forwarded-For", "Forwarded"}})
+		send(pc)
+
+		_, ok := received["X-Forwarded-For"]
+		assert.False(t, ok)
+		assert.Empty(t, received.Get("Forwarded"))
+	})
+
+	t.Run("allow and deny lists", func(t *testing.T) {
+		pc := newTestProxyClient(t, rules, upstream.URL, nil)
+		pc.SetHeaderPolicy(HeaderPolicy{
+			RequestDenyList:   []string{"x-internal-*"},
+			ResponseDenyList:  []string{"server", "X-Powered-By"},
+			ResponseAllowList: []string{"Content-*", "Server", "X-Request-Id"},
+		})
+		rec := send(pc)
+
+		assert.Empty(t, received.Get("X-Internal-Token"))
+		assert.Equal(t, "application/json", received.Get("Accept"))
+
+		assert.Empty(t, rec.Header().Get("Server"))
+		assert.Empty(t, rec.Header().Get("X-Powered-By"))
+		assert.Equal(t, "abc", rec.Header().Get("X-Request-Id"))
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		pc.SetHeaderPolicy(HeaderPolicy{RequestAllowList: []string{"Accept"}})
+		send(pc)
+
+		assert.Equal(t, "application/json", received.Get("Accept"))
+		assert.Empty(t, received.Get("X-Debug"))
+		assert.Empty(t, received.Get("X-Internal-Token"))
+		// Forwarded headers are added after filtering.
+		assert.Equal(t, "http", received.Get("X-Forwarded-Proto"))
+	})
+}
@@ -0,0 +1,84 @@
+package gl_routing
+
+import (
+	"net/http"
+)
+
+// Middleware wraps a http.Handler to add cross-cutting behavior such as logging, panic recovery or CORS.
+type Middleware func(http.Handler) http.Handler
+
+// chainMiddlewares wraps handler with middlewares.
+// The first middleware becomes the outermost one, therefore it is the first to see the request.
+func chainMiddlewares(middlewares []Middleware, handler http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Use registers global middlewares which wrap every request handled by ServeHTTP,
+// including the ones answered with 404 or 405.
+//
+// Middlewares are called in registration order.
+// It is not safe to call Use while the router is serving requests.
+func (sr *Router) Use(middlewares ...Middleware) {
+	sr.middlewares = append(sr.middlewares, middlewares...)
+	sr.handler = chainMiddlewares(sr.middlewares, http.HandlerFunc(sr.serve))
+}
+
+// RouteGroup registers route rules to a Router under a shared path prefix and middleware stack.
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+}
+
+// Group creates a route group whose rules are registered under prefix and wrapped with input middlewares.
+//
+// E.g.: router.Group("/api/v1", authMW).Add(&RouteRule{Method: "GET", Path: "/transfers"})
+// registers `/api/v1/transfers`.
+func (sr *Router) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:      sr,
+		prefix:      prefix,
+		middlewares: middlewares,
+	}
+}
+
+// Group creates a nested route group which inherits prefix and middlewares of the current group.
+func (g *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:      g.router,
+		prefix:      g.prefix + prefix,
+		middlewares: append(g.copyMiddlewares(), middlewares...),
+	}
+}
+
+// Use appends middlewares to the group's stack.
+//
+// Only rules which are added after the call are affected.
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// Add registers input route rules to the router.
+//
+// Copies of input rules are registered, whose paths are prefixed with the group prefix
+// and whose group middlewares are placed in front of the rule's own Middlewares.
+// Input rules are left unchanged, so that they can be added again if the call fails.
+func (g *RouteGroup) Add(routeRules ...*RouteRule) error {
+	grouped := make([]*RouteRule, 0, len(routeRules))
+	for _, r := range routeRules {
+		copied := *r
+		copied.Path = g.prefix + r.Path
+		copied.Middlewares = append(g.copyMiddlewares(), r.Middlewares...)
+		grouped = append(grouped, &copied)
+	}
+	return g.router.Add(grouped...)
+}
+
+func (g *RouteGroup) copyMiddlewares() []Middleware {
+	middlewares := make([]Middleware, len(g.middlewares))
+	copy(middlewares, g.middlewares)
+	return middlewares
+}
@@ -0,0 +1,107 @@
+package gl_routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware_Order(t *testing.T) {
+	var calls []string
+	tracer := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router, err := NewRouter(nil)
+	assert.NoError(t, err)
+	router.Use(tracer("global"))
+
+	v1 := router.Group("/api/v1", tracer("v1"))
+	transfers := v1.Group("/transfers", tracer("transfers"))
+
+	err = transfers.Add(&RouteRule{
+		Method:      `GET`,
+		Path:        `/{guid}`,
+		DynamicPath: true,
+		Middlewares: []Middleware{tracer("rule")},
+		AuthWith: func(sessionID string, w http.ResponseWriter, r *http.Request) error {
+			calls = append(calls, "auth")
+			return nil
+		},
+		RouteTo: func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+			assert.Equal(t, sessionID, SessionID(r))
+			calls = append(calls, "route:"+routeParams["guid"])
+		},
+	})
+	assert.NoError(t, err)
+
+	err = v1.Add(&RouteRule{Method: `GET`, Path: `/accounts`, RouteTo: func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+		calls = append(calls, "accounts")
+	}})
+	assert.NoError(t, err)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/v1/transfers/abc`, nil))
+	assert.Equal(t, []string{"global", "v1", "transfers", "rule", "auth", "route:abc"}, calls)
+
+	calls = nil
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/v1/accounts`, nil))
+	assert.Equal(t, []string{"global", "v1", "accounts"}, calls)
+
+	// Global middlewares also wrap unmatched requests.
+	calls = nil
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/v2/accounts`, nil))
+	assert.Equal(t, []string{"global"}, calls)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func Test_Middleware_Short_Circuit(t *testing.T) {
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+	}
+
+	router, err := NewRouter(nil)
+	assert.NoError(t, err)
+
+	err = router.Group("/admin", deny).Add(&RouteRule{Method: `GET`, Path: `/users`, RouteTo: func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+		t.Fatal("must not be called")
+	}})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/admin/users`, nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func Test_Route_Group_Add_Failure(t *testing.T) {
+	router, err := NewRouter(nil)
+	assert.NoError(t, err)
+
+	passThrough := func(next http.Handler) http.Handler {
+		return next
+	}
+	group := router.Group("/api", passThrough)
+	rule := &RouteRule{Method: `GET`, Path: `/transfers/{id`, DynamicPath: true}
+	assert.Error(t, group.Add(rule))
+
+	// Input rule is not changed, so it can be fixed and added again.
+	assert.Equal(t, `/transfers/{id`, rule.Path)
+	assert.Empty(t, rule.Middlewares)
+
+	rule.Path = `/transfers/{id}`
+	assert.NoError(t, group.Add(rule))
+	match := router.Match(httptest.NewRequest(`GET`, `/api/transfers/1`, nil))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, `/api/transfers/{id}`, match.Rule.Path)
+		assert.Len(t, match.Rule.Middlewares, 1)
+	}
+}
@@ -0,0 +1,589 @@
+package gl_routing
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheMaxBytes is the capacity of the LRUCacheStore used when CacheConfig.Store is nil.
+	DefaultCacheMaxBytes = 64 << 20
+	// DefaultCacheMaxBodySize is the default maximum body size of cached responses.
+	DefaultCacheMaxBodySize = 1 << 20
+)
+
+// CacheStatus tells how the response of a ProxyEvent relates to the cache.
+type CacheStatus string
+
+const (
+	// CacheHit means the response was served from the cache without contacting upstream.
+	CacheHit CacheStatus = "hit"
+	// CacheMiss means the response came from upstream.
+	CacheMiss CacheStatus = "miss"
+	// CacheRevalidated means upstream confirmed a stale cached response with 304, which was served.
+	CacheRevalidated CacheStatus = "revalidated"
+	// CacheBypass means the cache was skipped, e.g. the request had 'Cache-Control: no-store'.
+	CacheBypass CacheStatus = "bypass"
+)
+
+// CachedResponse is a response kept in a CacheStore.
+//
+// Cached responses are shared between requests and must not be modified.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Stored is the time the response was generated, corrected by its Age header.
+	Stored time.Time
+	// Expires is the time until which the response can be served without revalidation.
+	Expires time.Time
+	// Vary lists the request headers which select the variant of the response.
+	//
+	// Responses with Vary headers are stored under the key of their variant.
+	// Their URL key holds an index entry, which only has Vary set and a zero StatusCode.
+	Vary []string
+}
+
+func (c *CachedResponse) fresh(now time.Time) bool {
+	return now.Before(c.Expires)
+}
+
+func (c *CachedResponse) age(now time.Time) time.Duration {
+	return now.Sub(c.Stored)
+}
+
+func (c *CachedResponse) hasValidators() bool {
+	return c.Header.Get("ETag") != "" || c.Header.Get("Last-Modified") != ""
+}
+
+// size approximates the memory used by the response.
+func (c *CachedResponse) size() int64 {
+	size := int64(len(c.Body))
+	for name, values := range c.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	for _, name := range c.Vary {
+		size += int64(len(name))
+	}
+	return size
+}
+
+// CacheStore keeps cached responses by key.
+//
+// Stores can evict responses at any time, a missing response is a cache miss.
+// Responses should not be dropped at their Expires time, since stale responses with validators are revalidated
+// with upstream instead of being fetched again.
+// Responses with Vary headers are set as an index entry under the URL key and a separate entry per variant,
+// an index entry whose variant was evicted is a cache miss as well.
+type CacheStore interface {
+	// Get returns the response stored under key, nil if there is none.
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, res *CachedResponse) error
+	Delete(ctx context.Context, key string) error
+}
+
+// LRUCacheStore is a CacheStore which keeps responses in memory up to a total size.
+// Least recently used responses are evicted first.
+type LRUCacheStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	// Front of the list is the most recently used item.
+	order *list.List
+}
+
+type lruCacheItem struct {
+	key  string
+	res  *CachedResponse
+	size int64
+}
+
+// NewLRUCacheStore creates an in-memory store which holds responses of up to maxBytes in total.
+// Size of a response is approximated from its key, header and body, index entries of Vary responses are counted as well.
+func NewLRUCacheStore(maxBytes int64) *LRUCacheStore {
+	return &LRUCacheStore{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the response stored under key, nil if there is none.
+func (s *LRUCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*lruCacheItem).res, nil
+}
+
+// Set stores res under key, evicting least recently used responses until it fits.
+// Responses larger than the capacity of the store are not stored.
+func (s *LRUCacheStore) Set(ctx context.Context, key string, res *CachedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+
+	item := &lruCacheItem{key: key, res: res, size: int64(len(key)) + res.size()}
+	if item.size > s.maxBytes {
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(item)
+	s.size += item.size
+
+	for s.size > s.maxBytes {
+		s.remove(s.order.Back().Value.(*lruCacheItem).key)
+	}
+	return nil
+}
+
+// Delete removes the response stored under key.
+func (s *LRUCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+	return nil
+}
+
+// remove must be called while holding mu.
+func (s *LRUCacheStore) remove(key string) {
+	elem, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.order.Remove(elem)
+	delete(s.items, key)
+	s.size -= elem.Value.(*lruCacheItem).size
+}
+
+// CacheConfig defines how ProxyClient caches responses of GET requests.
+type CacheConfig struct {
+	// Store keeps cached responses. A LRUCacheStore of DefaultCacheMaxBytes is used if it is nil.
+	Store CacheStore
+	// DefaultTTL is the freshness lifetime of responses without Cache-Control max-age, s-maxage or Expires headers.
+	// If it is zero, such responses are only cached when they can be revalidated with ETag or Last-Modified.
+	DefaultTTL time.Duration
+	// MaxBodySize is the maximum body size of cached responses. DefaultCacheMaxBodySize is used if it is lower than 1.
+	MaxBodySize int
+}
+
+// cacheableStatus contains status codes which are cacheable by default (RFC 9110 15.1).
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// safeMethods are the methods which do not change the state of upstream (RFC 9110 9.2.1).
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// serveFromCache answers GET requests with a fresh cached response.
+// Stale responses which can be revalidated are set on the exchange, so that direct makes the upstream request conditional.
+//
+// It returns true if the request was answered.
+func (pc *ProxyClient) serveFromCache(w http.ResponseWriter, r *http.Request, exchange *proxyExchange) bool {
+	if r.Method != http.MethodGet || upgradeType(r.Header) != "" {
+		return false
+	}
+
+	reqDirectives := parseCacheControl(r.Header)
+	if _, ok := reqDirectives["no-store"]; ok || exchange.rule.cacheTTL < 0 {
+		exchange.cacheStatus = CacheBypass
+		return false
+	}
+
+	key := cacheKey(r)
+	res, err := pc.cacheLookup(r, key)
+	if err != nil {
+		pc.reportErr(fmt.Errorf("cache store error: %s", err.Error()), exchange.sessionID)
+		exchange.cacheStatus = CacheBypass
+		return false
+	}
+
+	exchange.cacheKey = key
+	exchange.cacheStatus = CacheMiss
+	if res == nil {
+		return false
+	}
+
+	now := time.Now()
+	if res.fresh(now) && !requiresRevalidation(reqDirectives, res.age(now)) {
+		exchange.cacheStatus = CacheHit
+		pc.writeCached(w, r, exchange, res, now)
+		return true
+	}
+
+	// Conditional requests of the client are forwarded as they are.
+	if res.hasValidators() && r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "" {
+		exchange.cacheEntry = res
+	}
+	return false
+}
+
+// cacheLookup returns the response stored for r, resolving the variant of responses with Vary headers.
+func (pc *ProxyClient) cacheLookup(r *http.Request, key string) (*CachedResponse, error) {
+	res, err := pc.cache.Store.Get(r.Context(), key)
+	if err != nil || res == nil || res.StatusCode != 0 {
+		return res, err
+	}
+	return pc.cache.Store.Get(r.Context(), variantKey(key, res.Vary, r.Header))
+}
+
+// writeCached writes a cached response, or 304 if it satisfies the conditional headers of r.
+func (pc *ProxyClient) writeCached(w http.ResponseWriter, r *http.Request, exchange *proxyExchange, res *CachedResponse, now time.Time) {
+	header := w.Header()
+	for name, values := range res.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(res.age(now).Seconds())))
+
+	exchange.resHeader = header.Clone()
+	if res.StatusCode == http.StatusOK && notModified(r.Header, res.Header) {
+		header.Del("Content-Length")
+		exchange.statusCode = http.StatusNotModified
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	exchange.statusCode = res.StatusCode
+	exchange.gotResponse = true
+	exchange.gzipped = res.Header.Get("Content-Encoding") == "gzip"
+	exchange.resCapture.Write(res.Body)
+
+	w.WriteHeader(res.StatusCode)
+	_, err := w.Write(res.Body)
+	if err != nil {
+		pc.reportErr(fmt.Errorf("write response error: %s", err.Error()), exchange.sessionID)
+	}
+}
+
+// cacheResponse stores cacheable upstream responses, replaces 304 responses to revalidation requests with the cached response
+// and invalidates cached responses of URLs which were changed with unsafe methods.
+func (pc *ProxyClient) cacheResponse(exchange *proxyExchange, res *http.Response) {
+	r := exchange.request
+	if !safeMethods[r.Method] {
+		if res.StatusCode < http.StatusBadRequest {
+			err := pc.cache.Store.Delete(r.Context(), cacheKey(r))
+			if err != nil {
+				pc.reportErr(fmt.Errorf("cache store error: %s", err.Error()), exchange.sessionID)
+			}
+		}
+		return
+	}
+
+	if exchange.cacheKey == "" {
+		return
+	}
+
+	now := time.Now()
+	if exchange.cacheEntry != nil && res.StatusCode == http.StatusNotModified {
+		cached := pc.refreshCached(exchange, exchange.cacheEntry, res.Header, now)
+		pc.cacheStore(exchange, cached)
+		exchange.cacheStatus = CacheRevalidated
+
+		res.Body.Close()
+		res.StatusCode = cached.StatusCode
+		res.Status = fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode))
+		res.Header = cached.Header.Clone()
+		res.ContentLength = int64(len(cached.Body))
+		res.Body = ioutil.NopCloser(bytes.NewReader(cached.Body))
+		return
+	}
+
+	cached := pc.newCached(exchange, res, now)
+	if cached == nil {
+		return
+	}
+
+	res.Body = &cacheFillReader{
+		ReadCloser: res.Body,
+		buf:        newCappedBuffer(pc.cache.MaxBodySize),
+		fill: func(body []byte) {
+			cached.Body = body
+			pc.cacheStore(exchange, cached)
+		},
+	}
+}
+
+// newCached returns a cache entry without body for res, nil if res must not be cached.
+func (pc *ProxyClient) newCached(exchange *proxyExchange, res *http.Response, now time.Time) *CachedResponse {
+	if !cacheableStatus[res.StatusCode] || res.ContentLength > int64(pc.cache.MaxBodySize) {
+		return nil
+	}
+
+	directives := parseCacheControl(res.Header)
+	if _, ok := directives["no-store"]; ok {
+		return nil
+	}
+	if _, ok := directives["private"]; ok {
+		return nil
+	}
+	// Cookies are specific to the client.
+	if res.Header.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	// Responses to authorized requests are only shared if upstream explicitly allows it (RFC 9111 3.5).
+	if exchange.request.Header.Get("Authorization") != "" {
+		_, public := directives["public"]
+		_, sMaxAge := directives["s-maxage"]
+		_, mustRevalidate := directives["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return nil
+		}
+	}
+
+	vary := varyHeaders(res.Header)
+	for _, name := range vary {
+		if name == "*" {
+			return nil
+		}
+	}
+
+	header := res.Header.Clone()
+	header.Del("Age")
+
+	cached := &CachedResponse{
+		StatusCode: res.StatusCode,
+		Header:     header,
+		Stored:     now.Add(-headerSeconds(res.Header, "Age")),
+		Vary:       vary,
+	}
+	cached.Expires = pc.cacheExpiry(exchange, header, cached.Stored)
+
+	if !cached.fresh(now) && !cached.hasValidators() {
+		return nil
+	}
+	return cached
+}
+
+// refreshCached returns a copy of cached, updated with the headers of a 304 response.
+func (pc *ProxyClient) refreshCached(exchange *proxyExchange, cached *CachedResponse, header http.Header, now time.Time) *CachedResponse {
+	refreshed := *cached
+	refreshed.Header = cached.Header.Clone()
+	for name, values := range header {
+		switch name {
+		case "Age", "Content-Length":
+			continue
+		}
+		refreshed.Header[name] = append([]string(nil), values...)
+	}
+
+	refreshed.Stored = now.Add(-headerSeconds(header, "Age"))
+	refreshed.Expires = pc.cacheExpiry(exchange, refreshed.Header, refreshed.Stored)
+	return &refreshed
+}
+
+// cacheExpiry returns the end of the freshness lifetime of a response generated at stored.
+//
+// TTL of the route overrides the lifetime defined by response headers, except 'Cache-Control: no-cache'.
+func (pc *ProxyClient) cacheExpiry(exchange *proxyExchange, header http.Header, stored time.Time) time.Time {
+	directives := parseCacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return stored
+	}
+
+	if exchange.rule.cacheTTL > 0 {
+		return stored.Add(exchange.rule.cacheTTL)
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return stored
+			}
+			return stored.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			// Invalid dates represent a time in the past (RFC 9111 5.3).
+			return stored
+		}
+		// Lifetime is calculated from the Date header to avoid clock skew between upstream and proxy.
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = stored
+		}
+		return stored.Add(expires.Sub(date))
+	}
+	return stored.Add(pc.cache.DefaultTTL)
+}
+
+// cacheStore stores cached under the key of the exchange, along with an index entry if it varies.
+func (pc *ProxyClient) cacheStore(exchange *proxyExchange, cached *CachedResponse) {
+	ctx := exchange.request.Context()
+	key := exchange.cacheKey
+
+	var err error
+	if len(cached.Vary) > 0 {
+		err = pc.cache.Store.Set(ctx, key, &CachedResponse{Stored: cached.Stored, Expires: cached.Expires, Vary: cached.Vary})
+		key = variantKey(key, cached.Vary, exchange.request.Header)
+	}
+	if err == nil {
+		err = pc.cache.Store.Set(ctx, key, cached)
+	}
+	if err != nil {
+		pc.reportErr(fmt.Errorf("cache store error: %s", err.Error()), exchange.sessionID)
+	}
+}
+
+// cacheFillReader collects the body of a response and calls fill once it was read completely.
+// Bodies which are larger than the buffer are not cached.
+type cacheFillReader struct {
+	io.ReadCloser
+	buf  *cappedBuffer
+	fill func(body []byte)
+	done bool
+}
+
+func (c *cacheFillReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.buf.Write(p[:n])
+	}
+	if err == io.EOF && !c.done {
+		c.done = true
+		if !c.buf.Truncated() {
+			c.fill(append([]byte(nil), c.buf.Bytes()...))
+		}
+	}
+	return n, err
+}
+
+// cacheKey returns the key of GET responses for the URL of r.
+func cacheKey(r *http.Request) string {
+	return http.MethodGet + " " + r.Host + r.URL.RequestURI()
+}
+
+// variantKey returns the key of the variant selected by vary headers of header.
+func variantKey(key string, vary []string, header http.Header) string {
+	var sb strings.Builder
+	sb.WriteString(key)
+	for _, name := range vary {
+		sb.WriteString("\n")
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// varyHeaders returns sorted canonical names of the Vary header.
+func varyHeaders(header http.Header) []string {
+	names := make([]string, 0)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseCacheControl returns directives of Cache-Control headers with lower case names and unquoted values.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, arg := directive, ""
+			if eq := strings.IndexByte(directive, '='); eq >= 0 {
+				name, arg = directive[:eq], strings.Trim(strings.TrimSpace(directive[eq+1:]), `"`)
+			}
+			directives[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return directives
+}
+
+// requiresRevalidation returns true if the request directives do not accept a cached response of input age.
+func requiresRevalidation(directives map[string]string, age time.Duration) bool {
+	if _, ok := directives["no-cache"]; ok {
+		return true
+	}
+	if value, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(value)
+		return err != nil || age > time.Duration(seconds)*time.Second
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since headers of a request against a response header.
+func notModified(reqHeader, resHeader http.Header) bool {
+	if ifNoneMatch := reqHeader.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := strings.TrimPrefix(resHeader.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(reqHeader.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(resHeader.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+func headerSeconds(header http.Header, name string) time.Duration {
+	seconds, err := strconv.Atoi(header.Get(name))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
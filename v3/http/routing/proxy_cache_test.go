@@ -0,0 +1,250 @@
+package gl_routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCachingProxyClient(t *testing.T, rules []*ProxyRouteRule, upstreamUrl string, events *[]*ProxyEvent) *ProxyClient {
+	routeTable, err := NewProxyRouteTable(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProxyClientWithOptions(routeTable,
+		WithRouteUrl(upstreamUrl),
+		WithCache(CacheConfig{}),
+		WithEventSink(func(event *ProxyEvent) {
+			*events = append(*events, event)
+		}),
+	)
+}
+
+func serveProxy(pc *ProxyClient, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, req)
+	return rec
+}
+
+func Test_Proxy_Cache(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(fmt.Sprintf("currencies %d", n)))
+	}))
+	defer upstream.Close()
+
+	var events []*ProxyEvent
+	pc := newTestCachingProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/currencies`),
+		NewProxyRouteRule(`POST`, `/currencies`),
+	}, upstream.URL, &events)
+
+	res := serveProxy(pc, http.MethodGet, "/currencies", nil)
+	assert.Equal(t, "currencies 1", res.Body.String())
+	assert.Equal(t, CacheMiss, events[0].CacheStatus)
+
+	res = serveProxy(pc, http.MethodGet, "/currencies", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "currencies 1", res.Body.String())
+	assert.Equal(t, "0", res.Header().Get("Age"))
+	assert.Equal(t, `"v1"`, res.Header().Get("ETag"))
+	assert.Equal(t, CacheHit, events[1].CacheStatus)
+	assert.Equal(t, []byte("currencies 1"), events[1].ResponseBody)
+	assert.Equal(t, "", events[1].Upstream)
+
+	// Query is part of the key.
+	res = serveProxy(pc, http.MethodGet, "/currencies?active=true", nil)
+	assert.Equal(t, "currencies 2", res.Body.String())
+
+	res = serveProxy(pc, http.MethodGet, "/currencies", http.Header{"If-None-Match": {`"v1"`}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	res = serveProxy(pc, http.MethodGet, "/currencies", http.Header{"Cache-Control": {"no-store"}})
+	assert.Equal(t, "currencies 3", res.Body.String())
+	assert.Equal(t, CacheBypass, events[len(events)-1].CacheStatus)
+
+	// Changes invalidate the cached response.
+	serveProxy(pc, http.MethodPost, "/currencies", nil)
+	res = serveProxy(pc, http.MethodGet, "/currencies", nil)
+	assert.Equal(t, "currencies 5", res.Body.String())
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+}
+
+func Test_Proxy_Cache_Revalidation(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-Revalidated", "true")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("banks"))
+	}))
+	defer upstream.Close()
+
+	var events []*ProxyEvent
+	pc := newTestCachingProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/banks`)}, upstream.URL, &events)
+
+	serveProxy(pc, http.MethodGet, "/banks", nil)
+	res := serveProxy(pc, http.MethodGet, "/banks", nil)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "banks", res.Body.String())
+	assert.Equal(t, "true", res.Header().Get("X-Revalidated"))
+	assert.Equal(t, CacheRevalidated, events[1].CacheStatus)
+	assert.Equal(t, http.StatusOK, events[1].StatusCode)
+	assert.Equal(t, http.StatusNotModified, events[1].UpstreamStatusCode)
+	assert.Equal(t, []byte("banks"), events[1].ResponseBody)
+}
+
+func Test_Proxy_Cache_Vary(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "accept-language")
+		w.Write([]byte("banks " + r.Header.Get("Accept-Language")))
+	}))
+	defer upstream.Close()
+
+	var events []*ProxyEvent
+	pc := newTestCachingProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/banks`)}, upstream.URL, &events)
+
+	for i := 0; i < 2; i++ {
+		for _, language := range []string{"en", "tr"} {
+			res := serveProxy(pc, http.MethodGet, "/banks", http.Header{"Accept-Language": {language}})
+			assert.Equal(t, "banks "+language, res.Body.String())
+		}
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func Test_Proxy_Cache_Not_Stored(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if cacheControl := r.URL.Query().Get("cc"); cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		if r.URL.Path == "/cookie" {
+			w.Header().Set("Set-Cookie", "session=1")
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}))
+	defer upstream.Close()
+
+	var events []*ProxyEvent
+	pc := newTestCachingProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/plain`),
+		NewProxyRouteRule(`GET`, `/cookie`),
+		NewProxyRouteRule(`GET`, `/disabled`).WithCacheTTL(-1),
+	}, upstream.URL, &events)
+
+	requests := []struct {
+		target string
+		header http.Header
+	}{
+		// No freshness and no validators.
+		{target: "/plain"},
+		{target: "/plain?cc=no-store"},
+		{target: "/plain?cc=private,max-age=60"},
+		{target: "/plain?cc=max-age=60", header: http.Header{"Authorization": {"Bearer token"}}},
+		{target: "/cookie"},
+		{target: "/disabled?cc=max-age=60"},
+	}
+
+	for _, req := range requests {
+		atomic.StoreInt32(&calls, 0)
+		serveProxy(pc, http.MethodGet, req.target, req.header)
+		serveProxy(pc, http.MethodGet, req.target, req.header)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls), req.target)
+	}
+
+	// Authorized responses are shared when upstream allows it.
+	atomic.StoreInt32(&calls, 0)
+	for i := 0; i < 2; i++ {
+		serveProxy(pc, http.MethodGet, "/plain?cc=public,max-age=60", http.Header{"Authorization": {"Bearer token"}})
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func Test_Proxy_Cache_Route_TTL(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Write([]byte("currencies"))
+	}))
+	defer upstream.Close()
+
+	var events []*ProxyEvent
+	pc := newTestCachingProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/currencies`).WithCacheTTL(time.Minute),
+	}, upstream.URL, &events)
+
+	serveProxy(pc, http.MethodGet, "/currencies", nil)
+	serveProxy(pc, http.MethodGet, "/currencies", nil)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	cached, _ := pc.cache.Store.Get(context.Background(), "GET example.com/currencies")
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, time.Minute, cached.Expires.Sub(cached.Stored))
+	}
+
+	// Clients can ask for responses which are not older than max-age.
+	time.Sleep(10 * time.Millisecond)
+	serveProxy(pc, http.MethodGet, "/currencies", http.Header{"Cache-Control": {"max-age=0"}})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func Test_LRU_Cache_Store(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUCacheStore(30)
+
+	store.Set(ctx, "a", &CachedResponse{Body: []byte("123456789")})
+	store.Set(ctx, "b", &CachedResponse{Body: []byte("123456789")})
+	store.Set(ctx, "c", &CachedResponse{Body: []byte("123456789")})
+
+	// Reading a makes b the least recently used item.
+	res, err := store.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+
+	store.Set(ctx, "d", &CachedResponse{Body: []byte("123456789")})
+
+	for key, exists := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		res, _ := store.Get(ctx, key)
+		assert.Equal(t, exists, res != nil, key)
+	}
+	assert.Equal(t, int64(30), store.size)
+
+	// Items larger than the store are not kept.
+	store.Set(ctx, "e", &CachedResponse{Body: make([]byte, 100)})
+	res, _ = store.Get(ctx, "e")
+	assert.Nil(t, res)
+
+	store.Delete(ctx, "a")
+	res, _ = store.Get(ctx, "a")
+	assert.Nil(t, res)
+	assert.Equal(t, int64(20), store.size)
+}
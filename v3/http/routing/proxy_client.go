@@ -3,33 +3,67 @@ package gl_routing
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
 	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	gl_http "github.com/payports/golib/v3/http"
 	gl_session "github.com/payports/golib/v3/session"
 )
 
+// DefaultBodyCaptureLimit is the default maximum number of body bytes captured for events and onReqRead and onResRead hooks.
+const DefaultBodyCaptureLimit = 1 << 20
+
 type responseWriter interface {
 	WriteCustomJsonResponse(w http.ResponseWriter, statusCode int, res interface{}) (writtenRes []byte, err error)
 }
 
 type ProxyClient struct {
-	routeTable     *RouteTable
+	// Holds *RouteTable. Swapped atomically on reloads.
+	routeTable     atomic.Value
 	routeUrl       string
 	httpCli        *http.Client
 	responseWriter responseWriter
 	ignoredPaths   map[string]bool
 
-	onErr     func(error, string)
-	onReqRead func([]byte, string)
-	onResRead func([]byte, string)
+	target         *url.URL
+	targetParseErr error
+	// Replaces routeUrl when it is set.
+	upstreams    *UpstreamPool
+	headerPolicy *compiledHeaderPolicy
+	renderError  ErrorRenderer
+	retryPolicy  RetryPolicy
+	// Nil while circuit breakers are disabled.
+	breakers     *circuitBreakers
+	reverseProxy *httputil.ReverseProxy
+	// Maximum number of body bytes captured for events.
+	bodyCaptureLimit int
+	// Nil while redaction is disabled.
+	redactor *Redactor
+	// Nil while rate limiting is disabled.
+	rateLimiter   *RateLimiter
+	upgradeConfig UpgradeConfig
+	// Nil while caching is disabled.
+	cache *CacheConfig
+
+	onErr func(error, string)
+	// Receive an event for every handled request. Body hooks of NewProxyClient are registered as one of them.
+	eventSinks []func(*ProxyEvent)
 }
 
 // NewProxyClient creates a new proxy client instance.
 // Underlying HandleRequestAndRedirect method can be registered as a handler function.
 // Handler function will redirect incoming request to the routeUrl.
+// Route rules can override the URL, path and timeout for their own requests (see ProxyRouteRule.WithUpstream).
 //
 // ignoredPaths will return 200 without any other http content.
 // (ignoredPaths must be exact paths. Regex is not supported.)
@@ -40,260 +74,544 @@ type ProxyClient struct {
 //
 // onReqRead: Can be registered to get incoming request body.
 //
-// onResRead: Can be registered to get outgoing response body.
+// onResRead: Can be registered to get outgoing response body. Gzip encoded bodies are decompressed.
+//
+// Body hooks are adapters over the ProxyEvent sink (see WithEventSink), therefore they are called after the exchange is complete.
 //
 // Hooks will contain a second string value which represents session ID.
 // Events which output the same session ID belong to same http session.
+//
+// See NewProxyClientWithOptions for the behavior of the proxy client.
 func NewProxyClient(routeTable *RouteTable, routeUrl string, httpCli *http.Client, responseWriter responseWriter, ignoredPaths []string, onErr func(error, string), onReqRead func([]byte, string), onResRead func([]byte, string)) *ProxyClient {
+	opts := []ProxyOption{
+		WithRouteUrl(routeUrl),
+		WithHttpClient(httpCli),
+		WithResponseWriter(responseWriter),
+		WithIgnoredPaths(ignoredPaths...),
+		WithOnErr(onErr),
+	}
+	if onReqRead != nil || onResRead != nil {
+		opts = append(opts, WithEventSink(legacyEventSink(onReqRead, onResRead)))
+	}
+	return NewProxyClientWithOptions(routeTable, opts...)
+}
+
+// NewProxyClientWithOptions creates a new proxy client instance configured with input options.
+// Underlying HandleRequestAndRedirect method can be registered as a handler function.
+//
+// Request and response bodies are streamed between client and upstream without being buffered in memory.
+// Only the Transport and Timeout of the http client (see WithHttpClient) are used.
+// Headers are passed according to a HeaderPolicy, which can be changed with SetHeaderPolicy.
+//
+// Failed requests are answered with a JSON body containing a message and the session ID (see DefaultErrorBody).
+// Upstream timeouts are answered with 504, other upstream failures with 502 and unavailable upstreams with 503.
+// Error responses can be customized with SetErrorRenderer.
+//
+// Upgrade requests (e.g. WebSocket) which pass the route table check are spliced to the upstream,
+// see SetUpgradeConfig for idle timeouts and connection events.
+//
+// Retries, circuit breakers, rate limiting and caching are disabled by default,
+// see SetRetryPolicy, SetCircuitBreaker, SetRateLimiter and SetCache.
+//
+// Every handled request is reported to event sinks as a ProxyEvent (see WithEventSink).
+// Event bodies are copies captured while streaming, capped at DefaultBodyCaptureLimit bytes,
+// which can be changed with SetBodyCaptureLimit.
+// Sensitive data can be masked before any hook sees it with SetRedactor.
+func NewProxyClientWithOptions(routeTable *RouteTable, opts ...ProxyOption) *ProxyClient {
 	pc := &ProxyClient{
-		routeTable:     routeTable,
-		routeUrl:       routeUrl,
-		httpCli:        httpCli,
-		responseWriter: responseWriter,
+		ignoredPaths:     make(map[string]bool),
+		bodyCaptureLimit: DefaultBodyCaptureLimit,
+		headerPolicy:     compileHeaderPolicy(HeaderPolicy{}),
+	}
 
-		onErr:     onErr,
-		onReqRead: onReqRead,
-		onResRead: onResRead,
+	pc.routeTable.Store(routeTable)
+
+	for _, opt := range opts {
+		opt(pc)
 	}
 
-	pc.ignoredPaths = make(map[string]bool, len(ignoredPaths))
-	for _, path := range ignoredPaths {
-		pc.ignoredPaths[path] = true
+	if pc.responseWriter == nil {
+		pc.responseWriter = gl_http.NewResponseWriter()
+	}
+	if pc.renderError == nil {
+		pc.renderError = NewJsonErrorRenderer(pc.responseWriter, nil)
+	}
+
+	pc.target, pc.targetParseErr = url.Parse(pc.routeUrl)
+
+	transport := http.DefaultTransport
+	if pc.httpCli != nil && pc.httpCli.Transport != nil {
+		transport = pc.httpCli.Transport
+	}
+
+	pc.reverseProxy = &httputil.ReverseProxy{
+		Director:       pc.direct,
+		Transport:      &upstreamTransport{pc: pc, base: transport},
+		ModifyResponse: pc.modifyResponse,
+		ErrorHandler:   pc.handleProxyError,
 	}
 	return pc
 }
 
+// SetBodyCaptureLimit changes the maximum number of body bytes captured for events and onReqRead and onResRead hooks.
+func (pc *ProxyClient) SetBodyCaptureLimit(limit int) {
+	pc.bodyCaptureLimit = limit
+}
+
+// SetUpgradeConfig changes idle timeout and connection hook of upgraded connections.
+//
+// Upgrade requests are not limited by the request timeout, since the connection lives as long as the request.
+func (pc *ProxyClient) SetUpgradeConfig(config UpgradeConfig) {
+	pc.upgradeConfig = config
+}
+
+// SetRateLimiter limits requests of each client with input rate limiter.
+// Route rules can override the default limit with ProxyRouteRule.WithRateLimit.
+//
+// Limited requests are answered with 429 and a Retry-After header, without being forwarded.
+// Store errors are reported through onErr and the request is allowed.
+func (pc *ProxyClient) SetRateLimiter(limiter *RateLimiter) {
+	pc.rateLimiter = limiter
+}
+
+// SetCache enables a shared HTTP cache (RFC 9111) for responses of GET requests.
+//
+// Freshness is taken from Cache-Control s-maxage and max-age or Expires headers of the response,
+// route rules can override it with ProxyRouteRule.WithCacheTTL.
+// Stale responses are revalidated with If-None-Match and If-Modified-Since headers.
+// Responses are stored separately for each combination of the request headers listed in their Vary header.
+//
+// Responses with 'Cache-Control: no-store' or 'private', Set-Cookie headers and responses to requests
+// with an Authorization header, unless upstream marks them public, are not cached.
+// Successful requests with unsafe methods, e.g. POST, remove the cached response of their URL.
+// Store errors are reported through onErr and the cache is skipped.
+func (pc *ProxyClient) SetCache(config CacheConfig) {
+	if config.Store == nil {
+		config.Store = NewLRUCacheStore(DefaultCacheMaxBytes)
+	}
+	if config.MaxBodySize < 1 {
+		config.MaxBodySize = DefaultCacheMaxBodySize
+	}
+	pc.cache = &config
+}
+
+// SetRedactor makes the proxy client mask sensitive data of events, body hooks and errors reported through onErr.
+// Proxied requests and responses are not changed.
+func (pc *ProxyClient) SetRedactor(redactor *Redactor) {
+	pc.redactor = redactor
+}
+
+// SetHeaderPolicy changes which headers are passed between client and upstream.
+//
+// By default hop-by-hop headers are removed (RFC 7230), every other header is passed
+// and X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and Forwarded headers are set from the client connection.
+func (pc *ProxyClient) SetHeaderPolicy(policy HeaderPolicy) {
+	pc.headerPolicy = compileHeaderPolicy(policy)
+}
+
+// SetErrorRenderer replaces the renderer of error responses, e.g. NewJsonErrorRenderer with a custom body.
+func (pc *ProxyClient) SetErrorRenderer(renderer ErrorRenderer) {
+	pc.renderError = renderer
+}
+
+// SetRetryPolicy enables retries of idempotent requests which failed because of the upstream.
+//
+// Retried request bodies are buffered in memory up to policy.MaxBufferedBody bytes.
+// Attempts are sent to the same upstream target and are reported through onErr.
+func (pc *ProxyClient) SetRetryPolicy(policy RetryPolicy) {
+	pc.retryPolicy = policy.withDefaults()
+}
+
+// SetCircuitBreaker enables a circuit breaker for each upstream target.
+// Requests to an upstream whose circuit is open are answered with 503 without being sent.
+func (pc *ProxyClient) SetCircuitBreaker(config CircuitBreakerConfig) {
+	if config.OnStateChange == nil {
+		config.OnStateChange = func(event *CircuitBreakerEvent) {
+			pc.reportErr(event, "")
+		}
+	}
+	pc.breakers = newCircuitBreakers(config)
+}
+
+// CircuitState returns the circuit breaker state of input upstream, e.g. 'http://10.0.0.1:8080'.
+// It returns CircuitClosed while circuit breakers are disabled.
+func (pc *ProxyClient) CircuitState(upstream string) CircuitState {
+	if pc.breakers == nil {
+		return CircuitClosed
+	}
+	return pc.breakers.state(upstream)
+}
+
+// SetUpstreamPool makes the proxy client distribute requests over the targets of input pool instead of routeUrl.
+//
+// Health state changes of the targets are reported through onErr as *UpstreamHealthEvent with an empty session ID.
+// A pool can be shared by several proxy clients, each of them receives the events.
+// Requests are answered with 503 while there is no healthy target.
+func (pc *ProxyClient) SetUpstreamPool(pool *UpstreamPool) {
+	pool.addListener(func(event *UpstreamHealthEvent) {
+		pc.reportErr(event, "")
+	})
+	pc.upstreams = pool
+}
+
 // HandleRequestAndRedirect can be registered to http.Handle() for redirecting requests to desired url.
+//
+// Cancellation of the incoming request is propagated to the upstream request.
 func (pc *ProxyClient) HandleRequestAndRedirect(w http.ResponseWriter, r *http.Request) {
 	if pc.ignoredPaths[r.URL.RequestURI()] {
 		w.Write(nil)
 		return
 	}
 
-	sessionID := gl_session.NewID()
+	exchange := &proxyExchange{
+		sessionID:  gl_session.NewID(),
+		start:      time.Now(),
+		request:    r,
+		target:     pc.target,
+		reqCapture: newCappedBuffer(pc.bodyCaptureLimit),
+		resCapture: newCappedBuffer(pc.bodyCaptureLimit),
+		timing:     &timingRecorder{},
+	}
+	sessionID := exchange.sessionID
 
-	uri := r.URL.RequestURI()
+	// Event is deferred, since ReverseProxy aborts the handler with a panic when the client goes away mid-response.
+	defer pc.emit(exchange)
 
-	isAllowed := false
+	uri := strings.Split(r.URL.RequestURI(), "?")[0]
 
-	for _, e := range pc.routeTable.routeRules {
+	var matchedRule *ProxyRouteRule
+
+	// Table is loaded once, therefore in-flight requests are not affected by reloads.
+	for _, e := range pc.RouteTable().routeRules {
 		if e.method != r.Method {
 			continue
 		}
 
-		regexConv, err := RouteToRegExp(uri)
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(err, sessionID)
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal server error",
-			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(err, sessionID)
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(writtenRes, sessionID)
-			}
-		}
-
-		if e.regexp.MatchString(regexConv) {
-			isAllowed = true
+		// Request path is client input, it is matched as it is instead of being parsed as a route expression.
+		if e.regexp.MatchString(uri) {
+			matchedRule = e
 			break
 		}
 	}
 
-	if !isAllowed {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("path is not allowed: %s", uri), sessionID)
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusUnauthorized, map[string]interface{}{
-			"message": "unauthorized call",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
-		}
+	if matchedRule == nil {
+		pc.reportErr(fmt.Errorf("path is not allowed: %s", uri), sessionID)
+		pc.writeError(w, r, exchange, &ProxyError{StatusCode: http.StatusUnauthorized, Message: "unauthorized call", SessionID: sessionID})
 		return
 	}
 
-	redirectUrl := pc.routeUrl + r.URL.RequestURI()
-	parsedRedirectUrl, err := url.Parse(redirectUrl)
-	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("unable to parse URL: '%s' error: %s", redirectUrl, err.Error()), sessionID)
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
+	exchange.rule = matchedRule
+
+	if pc.rateLimiter != nil {
+		result, err := pc.rateLimiter.take(r, matchedRule.method, matchedRule.path, matchedRule.rateLimit)
 		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
+			pc.reportErr(fmt.Errorf("rate limit store error: %s", err.Error()), sessionID)
+		} else {
+			setRateLimitHeaders(w.Header(), result)
+			if !result.Allowed {
+				pc.reportErr(fmt.Errorf("rate limit exceeded for path: %s", uri), sessionID)
+				pc.writeError(w, r, exchange, &ProxyError{StatusCode: http.StatusTooManyRequests, Message: "too many requests", SessionID: sessionID})
+				return
 			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
 		}
+	}
+
+	if pc.cache != nil && pc.serveFromCache(w, r, exchange) {
 		return
 	}
 
-	reqBytes, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("error reading request body: %s", err.Error()), sessionID)
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-			}
+	if matchedRule.upstreamUrl != nil {
+		exchange.target = matchedRule.upstreamUrl
+	} else if pc.upstreams != nil {
+		exchange.upstream = pc.upstreams.pick()
+		if exchange.upstream == nil {
+			pc.reportErr(fmt.Errorf("no healthy upstream available"), sessionID)
+			pc.writeError(w, r, exchange, &ProxyError{StatusCode: http.StatusServiceUnavailable, Message: "service unavailable", SessionID: sessionID})
 			return
 		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
-		}
+
+		exchange.target = exchange.upstream.url
+		pc.upstreams.acquire(exchange.upstream)
+		defer pc.upstreams.release(exchange.upstream)
+	} else if pc.targetParseErr != nil {
+		pc.reportErr(fmt.Errorf("unable to parse URL: '%s' error: %s", pc.routeUrl, pc.targetParseErr.Error()), sessionID)
+		pc.writeError(w, r, exchange, &ProxyError{StatusCode: http.StatusInternalServerError, Message: "internal error", SessionID: sessionID, Err: pc.targetParseErr})
 		return
 	}
 
-	if pc.onReqRead != nil {
-		pc.onReqRead(reqBytes, sessionID)
+	ctx := context.WithValue(r.Context(), proxyExchangeCtxKey{}, exchange)
+	ctx = httptrace.WithClientTrace(ctx, exchange.timing.clientTrace())
+
+	timeout := matchedRule.timeout
+	if timeout <= 0 && pc.httpCli != nil {
+		timeout = pc.httpCli.Timeout
+	}
+	// Upgraded connections live as long as the request context, they are limited by the idle timeout instead.
+	if timeout > 0 && upgradeType(r.Header) == "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	outReq := r.WithContext(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		outReq.Body = &teeReadCloser{ReadCloser: r.Body, w: exchange.reqCapture}
 	}
 
-	buffer := bytes.NewBuffer(reqBytes)
-	nopCloser := ioutil.NopCloser(buffer)
+	pc.reverseProxy.ServeHTTP(w, outReq)
+}
+
+// direct rewrites outgoing request to point to the target of the exchange.
+// Host header of the incoming request is preserved.
+func (pc *ProxyClient) direct(req *http.Request) {
+	exchange := proxyExchangeFromContext(req.Context())
+	target := exchange.target
+	targetPath := strings.TrimSuffix(target.Path, "/")
+
+	if exchange.rule.rewriteFrom != "" {
+		req.URL.Path = exchange.rule.rewritePath(req.URL.Path)
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = exchange.rule.rewriteRawPath(req.URL.RawPath)
+		}
+	}
 
-	httpReq := &http.Request{
-		Method: r.Method,
-		URL:    parsedRedirectUrl,
-		Header: r.Header,
-		Body:   nopCloser,
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = strings.TrimSuffix(target.EscapedPath(), "/") + req.URL.RawPath
 	}
+	req.URL.Path = targetPath + req.URL.Path
 
-	httpRes, err := pc.httpCli.Do(httpReq)
-	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("error executing http request: %s", err.Error()), sessionID)
+	if target.RawQuery != "" {
+		if req.URL.RawQuery == "" {
+			req.URL.RawQuery = target.RawQuery
+		} else {
+			req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
 		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-			}
-			return
+	}
+
+	pc.headerPolicy.applyToRequest(req)
+
+	// Stale cached response is revalidated, upstream answers with 304 if it is still valid.
+	if cached := exchange.cacheEntry; cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
 		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
 		}
-		return
 	}
+	exchange.upstreamUrl = req.URL.String()
+}
 
-	resBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("error reading response payload: %s", err.Error()), sessionID)
+func (pc *ProxyClient) modifyResponse(res *http.Response) error {
+	exchange := proxyExchangeFromContext(res.Request.Context())
+	if exchange == nil {
+		return nil
+	}
+
+	exchange.gotResponse = true
+	exchange.upstreamStatusCode = res.StatusCode
+	pc.headerPolicy.applyToResponse(res)
+
+	if exchange.upstream != nil {
+		var failure error
+		switch res.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			failure = fmt.Errorf("upstream returned status: %d", res.StatusCode)
 		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-			}
-			return
+		pc.upstreams.reportResult(exchange.upstream, failure)
+	}
+
+	if pc.cache != nil && res.StatusCode != http.StatusSwitchingProtocols {
+		pc.cacheResponse(exchange, res)
+	}
+
+	exchange.statusCode = res.StatusCode
+	exchange.resHeader = res.Header.Clone()
+	exchange.gzipped = res.Header.Get("Content-Encoding") == "gzip"
+
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		// ReverseProxy splices the client connection with the body of the response, which must stay writable.
+		if conn, ok := res.Body.(io.ReadWriteCloser); ok {
+			res.Body = newUpgradedConn(conn, pc.upgradeConfig, UpgradeEvent{
+				SessionID: exchange.sessionID,
+				Protocol:  upgradeType(res.Header),
+				Upstream:  exchange.upstreamUrl,
+			})
 		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
+		return nil
+	}
+
+	res.Body = &teeReadCloser{ReadCloser: res.Body, w: exchange.resCapture}
+	return nil
+}
+
+func (pc *ProxyClient) handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	sessionID := ""
+	exchange := proxyExchangeFromContext(r.Context())
+	if exchange != nil {
+		sessionID = exchange.sessionID
+		// Response was not copied to client, error response is reported in the event instead.
+		exchange.gotResponse = false
+		exchange.statusCode = 0
+		exchange.resHeader = nil
+	}
+
+	if errors.Is(err, context.Canceled) {
+		// Client has gone away, there is nobody to write a response to.
+		err = fmt.Errorf("request canceled: %s", err.Error())
+		if exchange != nil {
+			exchange.err = err
 		}
+		pc.reportErr(err, sessionID)
 		return
 	}
-	defer httpRes.Body.Close()
 
-	for k, v := range httpRes.Header {
-		for i := 0; i < len(v); i++ {
-			w.Header().Add(k, v[i])
-		}
+	if exchange != nil && exchange.upstream != nil && !errors.Is(err, ErrCircuitOpen) {
+		pc.upstreams.reportResult(exchange.upstream, err)
 	}
 
-	if httpRes.StatusCode != http.StatusOK {
-		w.WriteHeader(httpRes.StatusCode)
+	pc.reportErr(fmt.Errorf("error executing http request: %s", err.Error()), sessionID)
+	pc.writeError(w, r, exchange, newUpstreamError(err, sessionID))
+}
+
+// decodeCapturedResponse returns captured response body, decompressed if it is gzip encoded.
+func (pc *ProxyClient) decodeCapturedResponse(exchange *proxyExchange) []byte {
+	resBytes := exchange.resCapture.Bytes()
+	if !exchange.gzipped || len(resBytes) == 0 {
+		return resBytes
 	}
 
-	_, err = w.Write(resBytes)
+	gzipReader, err := gzip.NewReader(bytes.NewReader(resBytes))
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(fmt.Errorf("error writing server response for client: %s", err.Error()), sessionID)
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(writtenRes, sessionID)
-		}
+		pc.reportErr(fmt.Errorf("error creating gzip reader: %s", err.Error()), exchange.sessionID)
+		return resBytes
+	}
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(gzipReader, int64(pc.bodyCaptureLimit)))
+	// Truncated captures end with an unexpected EOF, whatever was decompressed until then is still useful.
+	if err != nil && !(exchange.resCapture.Truncated() && errors.Is(err, io.ErrUnexpectedEOF)) {
+		pc.reportErr(fmt.Errorf("error reading from gzip reader: %s", err.Error()), exchange.sessionID)
+		return resBytes
+	}
+	return decompressed
+}
+
+// writeError renders input error and records it on the exchange, if there is one.
+func (pc *ProxyClient) writeError(w http.ResponseWriter, r *http.Request, exchange *proxyExchange, proxyErr *ProxyError) {
+	writtenRes, err := pc.renderError(w, r, proxyErr)
+	if exchange != nil {
+		exchange.err = proxyErr
+	}
+	if err != nil {
+		pc.reportErr(fmt.Errorf("write response error: %s", err.Error()), proxyErr.SessionID)
 		return
 	}
 
-	if httpRes.Header.Get("Content-Encoding") == "gzip" {
-		reader := bytes.NewReader(resBytes)
-		gzipReader, err := gzip.NewReader(reader)
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("error creating gzip reader: %s", err.Error()), sessionID)
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal error",
-			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(writtenRes, sessionID)
-			}
-			return
-		}
-		/* Modifying resBytes for logging decompressed content AFTER we've written the response body. */
-		resBytes, err = ioutil.ReadAll(gzipReader)
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(fmt.Errorf("error reading from gzip reader: %s", err.Error()), sessionID)
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal error",
-			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(writtenRes, sessionID)
-			}
-			return
-		}
+	if exchange != nil {
+		exchange.statusCode = proxyErr.StatusCode
+		exchange.resHeader = w.Header().Clone()
+		exchange.errorBody = writtenRes
+	}
+}
+
+// reportErr hands input error to onErr hook, masked if a redactor is set.
+func (pc *ProxyClient) reportErr(err error, sessionID string) {
+	if pc.onErr == nil {
+		return
 	}
-	if pc.onResRead != nil {
-		pc.onResRead(resBytes, sessionID)
+	if pc.redactor != nil {
+		err = pc.redactor.RedactError(err)
 	}
+	pc.onErr(err, sessionID)
+}
+
+// emit reports the completed exchange to event sinks.
+func (pc *ProxyClient) emit(exchange *proxyExchange) {
+	if len(pc.eventSinks) == 0 {
+		return
+	}
+
+	r := exchange.request
+	event := &ProxyEvent{
+		SessionID:            exchange.sessionID,
+		Method:               r.Method,
+		Path:                 r.URL.Path,
+		RawQuery:             r.URL.RawQuery,
+		RemoteAddr:           r.RemoteAddr,
+		RequestHeader:        r.Header.Clone(),
+		RequestBody:          exchange.reqCapture.Bytes(),
+		RequestBodyTruncated: exchange.reqCapture.Truncated(),
+		Upstream:             exchange.upstreamUrl,
+		StatusCode:           exchange.statusCode,
+		UpstreamStatusCode:   exchange.upstreamStatusCode,
+		ResponseHeader:       exchange.resHeader,
+		CacheStatus:          exchange.cacheStatus,
+		Err:                  exchange.err,
+		Timing:               exchange.timing.result(),
+	}
+
+	if exchange.rule != nil {
+		event.Route = exchange.rule.path
+	}
+
+	if exchange.gotResponse {
+		event.ResponseBody = pc.decodeCapturedResponse(exchange)
+		event.ResponseBodyTruncated = exchange.resCapture.Truncated()
+	} else {
+		event.ResponseBody = exchange.errorBody
+	}
+
+	event.Timing.Start = exchange.start
+	event.Timing.Total = time.Since(exchange.start)
+
+	if pc.redactor != nil {
+		pc.redactor.RedactEvent(event)
+	}
+
+	for _, sink := range pc.eventSinks {
+		sink(event)
+	}
+}
+
+type proxyExchangeCtxKey struct{}
+
+// proxyExchange holds state of a single proxied request.
+type proxyExchange struct {
+	sessionID string
+	start     time.Time
+	// Request received from the client.
+	request *http.Request
+	// Route table rule which allowed the request.
+	rule *ProxyRouteRule
+	// Base URL which the request is forwarded to.
+	target *url.URL
+	// Picked target of the upstream pool, nil if the pool is not used.
+	upstream *upstream
+	// Full URL of the upstream request.
+	upstreamUrl string
+	reqCapture  *cappedBuffer
+	resCapture  *cappedBuffer
+	timing      *timingRecorder
+	gotResponse bool
+	gzipped     bool
+
+	// Key of the cached response for GET requests, empty if the cache is not used.
+	cacheKey string
+	// Stale cached response which is revalidated by the upstream request.
+	cacheEntry  *CachedResponse
+	cacheStatus CacheStatus
+
+	statusCode         int
+	upstreamStatusCode int
+	resHeader          http.Header
+	// Body of the error response written by the proxy client.
+	errorBody []byte
+	err       error
+}
+
+func proxyExchangeFromContext(ctx context.Context) *proxyExchange {
+	exchange, _ := ctx.Value(proxyExchangeCtxKey{}).(*proxyExchange)
+	return exchange
 }
@@ -1,8 +1,22 @@
 package gl_routing
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	gl_http "github.com/payports/golib/v3/http"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_Len_Of_Slice(t *testing.T) {
@@ -16,3 +30,191 @@ func Test_Len_Of_Slice(t *testing.T) {
 	sliceLen := len(slice)
 	fmt.Println(sliceLen)
 }
+
+func newTestProxyClient(t *testing.T, rules []*ProxyRouteRule, upstreamUrl string, onErr func(error, string)) *ProxyClient {
+	routeTable, err := NewProxyRouteTable(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProxyClient(routeTable, upstreamUrl, http.DefaultClient, gl_http.NewResponseWriter(), nil, onErr, nil, nil)
+}
+
+func Test_Proxy_Route_Table_Reload(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)}, upstream.URL, func(err error, sessionID string) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	statusOf := func(path string) int {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, statusOf(`/api/accounts`))
+	assert.Equal(t, http.StatusUnauthorized, statusOf(`/api/transfers/1`))
+
+	err := pc.ReloadRouteRules([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/transfers/{id:int}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, statusOf(`/api/accounts`))
+	assert.Equal(t, http.StatusOK, statusOf(`/api/transfers/1`))
+
+	// Invalid tables are rejected and the previous one stays active.
+	previous := pc.RouteTable()
+	err = pc.ReloadRouteRules([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/transfers/{id:[0-9}`)})
+	assert.Error(t, err)
+	assert.Equal(t, previous, pc.RouteTable())
+	assert.Equal(t, http.StatusOK, statusOf(`/api/transfers/1`))
+
+	pc.ReplaceRouteTable(nil)
+	assert.Equal(t, previous, pc.RouteTable())
+	assert.Equal(t, http.StatusOK, statusOf(`/api/transfers/1`))
+
+	mu.Lock()
+	assert.Len(t, errs, 4)
+	assert.EqualError(t, errs[3], "route table reload rejected: route table is nil")
+	mu.Unlock()
+}
+
+func Test_Proxy_Route_Config_File_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("routes:\n  - methods: [GET]\n    path: /api/accounts\n")
+
+	errCh := make(chan error, 10)
+	pc := newTestProxyClient(t, nil, "http://localhost", func(err error, sessionID string) {
+		errCh <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, pc.WatchRouteConfigFile(ctx, path, 5*time.Millisecond))
+
+	assert.Eventually(t, func() bool {
+		return len(pc.RouteTable().routeRules) == 1
+	}, time.Second, 5*time.Millisecond)
+	loaded := pc.RouteTable()
+
+	writeConfig("routes:\n  - methods: [GET]\n    path: /api/{id\n")
+	select {
+	case err := <-errCh:
+		assert.Contains(t, err.Error(), "route table reload rejected")
+	case <-time.After(time.Second):
+		t.Fatal("reload error was not reported")
+	}
+	assert.Equal(t, loaded, pc.RouteTable())
+
+	assert.Error(t, pc.WatchRouteConfigFile(ctx, "routes.txt", time.Second))
+}
+
+func Test_Proxy_Streaming_Bodies(t *testing.T) {
+	const bodySize = 3 << 20
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gateway.local", r.Host)
+		assert.Equal(t, int64(bodySize), r.ContentLength)
+		assert.Equal(t, "/base/api/upload", r.URL.Path)
+		assert.Equal(t, "a=1&b=2", r.URL.RawQuery)
+
+		n, err := io.Copy(ioutil.Discard, r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(bodySize), n)
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+
+		gz := gzip.NewWriter(w)
+		gz.Write(bytes.Repeat([]byte("r"), bodySize))
+		gz.Close()
+	}))
+	defer upstream.Close()
+
+	var reqRead, resRead []byte
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`POST`, `/api/upload`)})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(routeTable, upstream.URL+"/base?a=1", http.DefaultClient, gl_http.NewResponseWriter(), nil,
+		func(err error, sessionID string) { t.Errorf("unexpected error: %s", err.Error()) },
+		func(b []byte, sessionID string) { reqRead = b },
+		func(b []byte, sessionID string) { resRead = b },
+	)
+	pc.SetBodyCaptureLimit(1024)
+
+	req := httptest.NewRequest(`POST`, `http://gateway.local/api/upload?b=2`, bytes.NewReader(bytes.Repeat([]byte("q"), bodySize)))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "yes", rec.Header().Get("X-Upstream"))
+
+	gz, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	resBody, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Len(t, resBody, bodySize)
+
+	assert.Equal(t, bytes.Repeat([]byte("q"), 1024), reqRead)
+	assert.Equal(t, bytes.Repeat([]byte("r"), len(resRead)), resRead)
+	assert.NotEmpty(t, resRead)
+}
+
+func Test_Proxy_Client_Cancellation(t *testing.T) {
+	upstreamCanceled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(upstreamCanceled)
+	}))
+	defer upstream.Close()
+
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/events`)}, upstream.URL, nil)
+	gateway := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer gateway.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, `GET`, gateway.URL+`/events`, nil)
+	assert.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	cancel()
+	res.Body.Close()
+
+	select {
+	case <-upstreamCanceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancellation was not propagated to upstream")
+	}
+}
+
+func Test_Proxy_Upstream_Unavailable(t *testing.T) {
+	var errs []error
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)}, "http://127.0.0.1:1", func(err error, sessionID string) {
+		errs = append(errs, err)
+	})
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/api/accounts`, nil))
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Len(t, errs, 1)
+}
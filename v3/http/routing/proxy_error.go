@@ -0,0 +1,80 @@
+package gl_routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ProxyError describes a request which ProxyClient could not forward or whose upstream failed.
+type ProxyError struct {
+	// StatusCode is the http status written to the client.
+	StatusCode int
+	// Message is a short description which is safe to return to the client.
+	Message   string
+	SessionID string
+	// Err is the underlying error, nil if the request was rejected by ProxyClient itself.
+	Err error
+}
+
+func (e *ProxyError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Message, e.Err.Error())
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorRenderer writes the response of a failed request and returns the written body, which is handed to onResRead hook.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, proxyErr *ProxyError) (writtenRes []byte, err error)
+
+// NewJsonErrorRenderer creates an ErrorRenderer which writes the value returned from body as JSON with responseWriter.
+//
+// If body is nil, DefaultErrorBody is used.
+func NewJsonErrorRenderer(responseWriter responseWriter, body func(proxyErr *ProxyError) interface{}) ErrorRenderer {
+	if body == nil {
+		body = DefaultErrorBody
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, proxyErr *ProxyError) ([]byte, error) {
+		return responseWriter.WriteCustomJsonResponse(w, proxyErr.StatusCode, body(proxyErr))
+	}
+}
+
+// DefaultErrorBody returns the message and session ID of input error,
+// e.g. '{"message":"gateway timeout","sessionId":"..."}'.
+func DefaultErrorBody(proxyErr *ProxyError) interface{} {
+	return map[string]interface{}{
+		"message":   proxyErr.Message,
+		"sessionId": proxyErr.SessionID,
+	}
+}
+
+// newUpstreamError maps an error of the upstream round trip to a ProxyError.
+//
+// Open circuit breakers are mapped to 503, timeouts (including dial timeouts) to 504
+// and any other failure (e.g. refused connection) to 502.
+func newUpstreamError(err error, sessionID string) *ProxyError {
+	proxyErr := &ProxyError{
+		StatusCode: http.StatusBadGateway,
+		Message:    "bad gateway",
+		SessionID:  sessionID,
+		Err:        err,
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		proxyErr.StatusCode = http.StatusServiceUnavailable
+		proxyErr.Message = "service unavailable"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		proxyErr.StatusCode = http.StatusGatewayTimeout
+		proxyErr.Message = "gateway timeout"
+	}
+	return proxyErr
+}
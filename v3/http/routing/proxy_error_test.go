@@ -0,0 +1,107 @@
+package gl_routing
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Error_Mapping(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	// Upstream which accepts connections and closes them without a response.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	var sessionIDs []string
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/slow`).WithUpstream(slow.URL).WithTimeout(20 * time.Millisecond),
+		NewProxyRouteRule(`GET`, `/refused`).WithUpstream("http://127.0.0.1:1"),
+		NewProxyRouteRule(`GET`, `/closed`).WithUpstream("http://" + listener.Addr().String()),
+	}, slow.URL, func(err error, sessionID string) {
+		sessionIDs = append(sessionIDs, sessionID)
+	})
+
+	type testData struct {
+		path       string
+		statusCode int
+		message    string
+	}
+
+	data := []testData{
+		{path: `/slow`, statusCode: http.StatusGatewayTimeout, message: "gateway timeout"},
+		{path: `/refused`, statusCode: http.StatusBadGateway, message: "bad gateway"},
+		{path: `/closed`, statusCode: http.StatusBadGateway, message: "bad gateway"},
+		{path: `/unknown`, statusCode: http.StatusUnauthorized, message: "unauthorized call"},
+	}
+
+	for _, td := range data {
+		sessionIDs = nil
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, td.path, nil))
+
+		var body map[string]string
+		err := json.Unmarshal(rec.Body.Bytes(), &body)
+		assert.NoError(t, err, td.path)
+
+		assert.Equal(t, td.statusCode, rec.Code, td.path)
+		assert.Equal(t, td.message, body["message"], td.path)
+		if assert.Len(t, sessionIDs, 1, td.path) {
+			assert.Equal(t, sessionIDs[0], body["sessionId"], td.path)
+		}
+	}
+}
+
+func Test_Proxy_Custom_Error_Renderer(t *testing.T) {
+	var rendered *ProxyError
+	var resBodies []string
+
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := NewProxyClient(routeTable, "http://127.0.0.1:1", http.DefaultClient, nil, nil, nil, nil, func(body []byte, sessionID string) {
+		resBodies = append(resBodies, string(body))
+	})
+	pc.SetErrorRenderer(func(w http.ResponseWriter, r *http.Request, proxyErr *ProxyError) ([]byte, error) {
+		rendered = proxyErr
+		body := []byte(proxyErr.Message)
+		w.WriteHeader(proxyErr.StatusCode)
+		_, err := w.Write(body)
+		return body, err
+	})
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/api/accounts`, nil))
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "bad gateway", rec.Body.String())
+	assert.Equal(t, []string{"bad gateway"}, resBodies)
+	if assert.NotNil(t, rendered) {
+		assert.Error(t, rendered.Err)
+		assert.NotEmpty(t, rendered.SessionID)
+	}
+}
@@ -0,0 +1,136 @@
+package gl_routing
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ProxyEvent describes a single exchange handled by ProxyClient.
+// It is handed to the event sink after the exchange is complete.
+type ProxyEvent struct {
+	SessionID string
+
+	Method     string
+	Path       string
+	RawQuery   string
+	RemoteAddr string
+	// RequestHeader contains headers received from the client.
+	RequestHeader http.Header
+	// RequestBody is the captured request body, capped at the body capture limit.
+	RequestBody          []byte
+	RequestBodyTruncated bool
+
+	// Route is the path of the matched route rule, empty if the request was not allowed.
+	Route string
+	// Upstream is the URL which the request was sent to, empty if the request was not forwarded.
+	Upstream string
+
+	// StatusCode is the status written to the client, 0 if no response was written (e.g. the client has gone away).
+	StatusCode int
+	// UpstreamStatusCode is the status returned from upstream, 0 if there was no upstream response.
+	UpstreamStatusCode int
+	// ResponseHeader contains headers written to the client.
+	ResponseHeader http.Header
+	// ResponseBody is the captured response body, capped at the body capture limit. Gzip encoded bodies are decompressed.
+	ResponseBody          []byte
+	ResponseBodyTruncated bool
+	// CacheStatus tells whether the response was served from the cache, empty if the cache was not used.
+	CacheStatus CacheStatus
+
+	// Err is the failure of the exchange, *ProxyError if an error response was written. Nil on success.
+	Err error
+
+	Timing ProxyTiming
+}
+
+// ProxyTiming is the timing breakdown of a ProxyEvent.
+//
+// Connection timings are zero when a pooled connection was reused.
+// When the request was retried, they belong to the last attempt.
+type ProxyTiming struct {
+	Start time.Time
+	// DNSLookup, Connect and TLSHandshake are the durations of upstream connection setup.
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the duration from sending the request to receiving the first response byte from upstream.
+	TimeToFirstByte time.Duration
+	// Total is the duration from receiving the request to completing the response.
+	Total time.Duration
+}
+
+// legacyEventSink adapts onReqRead and onResRead hooks of NewProxyClient to an event sink.
+func legacyEventSink(onReqRead, onResRead func([]byte, string)) func(*ProxyEvent) {
+	return func(event *ProxyEvent) {
+		if onReqRead != nil && event.Upstream != "" {
+			onReqRead(event.RequestBody, event.SessionID)
+		}
+		if onResRead != nil && event.StatusCode != 0 {
+			onResRead(event.ResponseBody, event.SessionID)
+		}
+	}
+}
+
+// timingRecorder collects connection timings of an upstream request.
+// httptrace hooks can be called from other goroutines, therefore it is guarded by a mutex.
+type timingRecorder struct {
+	mu sync.Mutex
+
+	dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	timing                                         ProxyTiming
+}
+
+func (t *timingRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.timing.DNSLookup = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			t.connectStart = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.timing.Connect = time.Since(t.connectStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.timing.TLSHandshake = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wroteRequest = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.timing.TimeToFirstByte = time.Since(t.wroteRequest)
+			t.mu.Unlock()
+		},
+	}
+}
+
+// result returns recorded timings.
+func (t *timingRecorder) result() ProxyTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
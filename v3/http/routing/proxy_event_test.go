@@ -0,0 +1,90 @@
+package gl_routing
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Event_Sink(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Request-Id", "abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"received":` + string(body) + `}`))
+	}))
+	defer upstream.Close()
+
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`POST`, `/api/accounts/{id:int}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []*ProxyEvent
+	var reqBodies, resBodies []string
+	pc := NewProxyClientWithOptions(routeTable,
+		WithRouteUrl(upstream.URL),
+		WithBodyCaptureLimit(16),
+		WithEventSink(func(event *ProxyEvent) {
+			events = append(events, event)
+		}),
+		WithEventSink(legacyEventSink(func(body []byte, sessionID string) {
+			reqBodies = append(reqBodies, string(body))
+		}, func(body []byte, sessionID string) {
+			resBodies = append(resBodies, string(body))
+		})),
+	)
+
+	req := httptest.NewRequest(`POST`, `/api/accounts/12?verbose=1`, strings.NewReader(`{"name":"main"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/api/transfers`, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	if !assert.Len(t, events, 2) {
+		return
+	}
+
+	event := events[0]
+	assert.NotEmpty(t, event.SessionID)
+	assert.Equal(t, `POST`, event.Method)
+	assert.Equal(t, `/api/accounts/12`, event.Path)
+	assert.Equal(t, `verbose=1`, event.RawQuery)
+	assert.Equal(t, `/api/accounts/{id:int}`, event.Route)
+	assert.Equal(t, upstream.URL+`/api/accounts/12?verbose=1`, event.Upstream)
+	assert.Equal(t, "application/json", event.RequestHeader.Get("Content-Type"))
+	assert.Equal(t, `{"name":"main"}`, string(event.RequestBody))
+	assert.False(t, event.RequestBodyTruncated)
+	assert.Equal(t, http.StatusCreated, event.StatusCode)
+	assert.Equal(t, http.StatusCreated, event.UpstreamStatusCode)
+	assert.Equal(t, "abc", event.ResponseHeader.Get("X-Request-Id"))
+	assert.Equal(t, `{"received":{"na`, string(event.ResponseBody))
+	assert.True(t, event.ResponseBodyTruncated)
+	assert.NoError(t, event.Err)
+	assert.False(t, event.Timing.Start.IsZero())
+	assert.True(t, event.Timing.Connect > 0)
+	assert.True(t, event.Timing.TimeToFirstByte > 0)
+	assert.True(t, event.Timing.Total >= event.Timing.TimeToFirstByte)
+
+	event = events[1]
+	assert.Empty(t, event.Route)
+	assert.Empty(t, event.Upstream)
+	assert.Equal(t, http.StatusUnauthorized, event.StatusCode)
+	assert.Equal(t, 0, event.UpstreamStatusCode)
+	assert.Contains(t, string(event.ResponseBody), `"unauthorized call"`)
+	if proxyErr, ok := event.Err.(*ProxyError); assert.True(t, ok) {
+		assert.Equal(t, event.SessionID, proxyErr.SessionID)
+	}
+
+	// Rejected requests are not read, therefore only the response is handed to legacy hooks.
+	assert.Equal(t, []string{`{"name":"main"}`}, reqBodies)
+	assert.Equal(t, []string{`{"received":{"na`, string(events[1].ResponseBody)}, resBodies)
+}
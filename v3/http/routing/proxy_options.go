@@ -0,0 +1,121 @@
+package gl_routing
+
+import "net/http"
+
+// ProxyOption configures a ProxyClient created with NewProxyClientWithOptions.
+type ProxyOption func(pc *ProxyClient)
+
+// WithRouteUrl sets the URL which allowed requests are redirected to.
+func WithRouteUrl(routeUrl string) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.routeUrl = routeUrl
+	}
+}
+
+// WithHttpClient sets the client whose Transport and Timeout are used for upstream requests.
+func WithHttpClient(httpCli *http.Client) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.httpCli = httpCli
+	}
+}
+
+// WithResponseWriter sets the writer of the default error renderer.
+func WithResponseWriter(responseWriter responseWriter) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.responseWriter = responseWriter
+	}
+}
+
+// WithIgnoredPaths sets exact paths which are answered with 200 without any other http content.
+func WithIgnoredPaths(ignoredPaths ...string) ProxyOption {
+	return func(pc *ProxyClient) {
+		for _, path := range ignoredPaths {
+			pc.ignoredPaths[path] = true
+		}
+	}
+}
+
+// WithOnErr registers a hook which receives internal errors along with the session ID.
+func WithOnErr(onErr func(error, string)) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.onErr = onErr
+	}
+}
+
+// WithEventSink registers a sink which receives a ProxyEvent for every handled request.
+// Events are delivered after the exchange is complete, on the goroutine which handled the request.
+func WithEventSink(sink func(event *ProxyEvent)) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.eventSinks = append(pc.eventSinks, sink)
+	}
+}
+
+// WithBodyCaptureLimit sets the maximum number of body bytes captured for events (see SetBodyCaptureLimit).
+func WithBodyCaptureLimit(limit int) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetBodyCaptureLimit(limit)
+	}
+}
+
+// WithRateLimiter limits requests of each client (see SetRateLimiter).
+func WithRateLimiter(limiter *RateLimiter) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetRateLimiter(limiter)
+	}
+}
+
+// WithUpgradeConfig sets idle timeout and connection hook of upgraded connections (see SetUpgradeConfig).
+func WithUpgradeConfig(config UpgradeConfig) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetUpgradeConfig(config)
+	}
+}
+
+// WithCache enables caching of GET responses (see SetCache).
+func WithCache(config CacheConfig) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetCache(config)
+	}
+}
+
+// WithRedactor masks sensitive data before hooks see it (see SetRedactor).
+func WithRedactor(redactor *Redactor) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetRedactor(redactor)
+	}
+}
+
+// WithHeaderPolicy sets the header policy (see SetHeaderPolicy).
+func WithHeaderPolicy(policy HeaderPolicy) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetHeaderPolicy(policy)
+	}
+}
+
+// WithErrorRenderer sets the renderer of error responses (see SetErrorRenderer).
+func WithErrorRenderer(renderer ErrorRenderer) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetErrorRenderer(renderer)
+	}
+}
+
+// WithRetryPolicy enables retries (see SetRetryPolicy).
+func WithRetryPolicy(policy RetryPolicy) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetRetryPolicy(policy)
+	}
+}
+
+// WithCircuitBreaker enables circuit breakers (see SetCircuitBreaker).
+func WithCircuitBreaker(config CircuitBreakerConfig) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetCircuitBreaker(config)
+	}
+}
+
+// WithUpstreamPool distributes requests over the targets of input pool (see SetUpstreamPool).
+func WithUpstreamPool(pool *UpstreamPool) ProxyOption {
+	return func(pc *ProxyClient) {
+		pc.SetUpstreamPool(pool)
+	}
+}
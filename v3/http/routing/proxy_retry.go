@@ -0,0 +1,157 @@
+package gl_routing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	gl_http "github.com/payports/golib/v3/http"
+)
+
+// RetryPolicy defines how ProxyClient retries failed upstream requests.
+//
+// Only idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT, DELETE) are retried.
+// Connection errors, timeouts and 502, 503, 504 responses are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one. Retries are disabled when it is lower than 2.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles for every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration
+	// MaxBufferedBody is the maximum request body size which is buffered for replaying.
+	// Requests with larger bodies are sent only once.
+	MaxBufferedBody int64
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 2 * time.Second
+	}
+	if p.MaxBufferedBody <= 0 {
+		p.MaxBufferedBody = DefaultBodyCaptureLimit
+	}
+	return p
+}
+
+// backoff returns the wait before input retry, see gl_http.Backoff.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	return gl_http.Backoff(retry, p.InitialBackoff, p.MaxBackoff)
+}
+
+// upstreamTransport sends requests of ProxyClient to upstreams with retries and circuit breakers.
+type upstreamTransport struct {
+	pc   *ProxyClient
+	base http.RoundTripper
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pc := t.pc
+	sessionID := ""
+	if exchange := proxyExchangeFromContext(req.Context()); exchange != nil {
+		sessionID = exchange.sessionID
+	}
+
+	attempts := 1
+	if pc.retryPolicy.MaxAttempts > 1 && gl_http.IsIdempotentMethod(req.Method) {
+		attempts = pc.retryPolicy.MaxAttempts
+	}
+
+	var body []byte
+	if attempts > 1 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(req.Body, pc.retryPolicy.MaxBufferedBody+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not read request body: %s", err.Error())
+		}
+
+		if int64(len(body)) > pc.retryPolicy.MaxBufferedBody {
+			// Too large to replay, the buffered part is sent followed by the rest of the stream.
+			// The copy carries the combined body, since RoundTrip must not modify the incoming request.
+			attempts = 1
+			streamed := req.WithContext(req.Context())
+			streamed.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+			req = streamed
+			body = nil
+		} else {
+			req.Body.Close()
+		}
+	}
+
+	upstream := req.URL.Scheme + "://" + req.URL.Host
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if body != nil {
+			attemptReq = req.WithContext(req.Context())
+			attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		res, err := t.roundTripWithBreaker(attemptReq, upstream)
+		if !isRetryableResult(res, err) || attempt >= attempts || req.Context().Err() != nil {
+			return res, err
+		}
+
+		cause := err
+		if res != nil {
+			cause = fmt.Errorf("upstream returned status: %d", res.StatusCode)
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		pc.reportErr(fmt.Errorf("retrying request, attempt: %d error: %s", attempt, cause.Error()), sessionID)
+
+		timer := time.NewTimer(pc.retryPolicy.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *upstreamTransport) roundTripWithBreaker(req *http.Request, upstream string) (*http.Response, error) {
+	if t.pc.breakers == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	breaker := t.pc.breakers.get(upstream)
+	if !breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if errors.Is(err, context.Canceled) {
+		// Client has gone away, which says nothing about the upstream.
+		breaker.abandon()
+		return res, err
+	}
+	breaker.record(!isRetryableResult(res, err))
+	return res, err
+}
+
+// isRetryableResult returns true if a round trip has failed because of the upstream.
+func isRetryableResult(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrCircuitOpen)
+	}
+
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,126 @@
+package gl_routing
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Retries(t *testing.T) {
+	var calls int32
+	var mu sync.Mutex
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+
+		// Every second call fails, as if the backend was restarting.
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	var errs []error
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`PUT`, `/api/accounts`),
+		NewProxyRouteRule(`POST`, `/api/accounts`),
+	}, upstream.URL, func(err error, sessionID string) {
+		errs = append(errs, err)
+	})
+	pc.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	send := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(method, `/api/accounts`, strings.NewReader(`{"id":1}`)))
+		return rec
+	}
+
+	// Idempotent requests are replayed with the same body.
+	rec := send(`PUT`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, []string{`{"id":1}`, `{"id":1}`}, bodies)
+	assert.Len(t, errs, 1)
+
+	// Other requests are sent once.
+	rec = send(`POST`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Bodies larger than MaxBufferedBody are not replayed.
+	pc.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBufferedBody: 4})
+	atomic.StoreInt32(&calls, 0)
+	bodies = nil
+	rec = send(`PUT`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, []string{`{"id":1}`}, bodies)
+
+	// Transport does not modify the request it was given.
+	req, err := http.NewRequest(`PUT`, upstream.URL+`/api/accounts`, ioutil.NopCloser(strings.NewReader(`{"id":1}`)))
+	assert.NoError(t, err)
+	originalBody := req.Body
+	res, err := pc.reverseProxy.Transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+	}
+	assert.Equal(t, originalBody, req.Body)
+}
+
+func Test_Proxy_Circuit_Breaker(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	var events []*CircuitBreakerEvent
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)}, upstream.URL, func(err error, sessionID string) {
+		if event, ok := err.(*CircuitBreakerEvent); ok {
+			events = append(events, event)
+		}
+	})
+	pc.SetCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute})
+
+	statusOf := func() int {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/api/accounts`, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusBadGateway, statusOf())
+	assert.Equal(t, http.StatusBadGateway, statusOf())
+	assert.Equal(t, CircuitOpen, pc.CircuitState(upstream.URL))
+
+	// Open circuit rejects requests without sending them.
+	assert.Equal(t, http.StatusServiceUnavailable, statusOf())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, upstream.URL, events[0].Upstream)
+		assert.Equal(t, CircuitClosed, events[0].From)
+		assert.Equal(t, CircuitOpen, events[0].To)
+	}
+}
+
+func Test_Retry_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}.withDefaults()
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, policy.backoff(1) >= 50*time.Millisecond && policy.backoff(1) <= 100*time.Millisecond)
+		assert.True(t, policy.backoff(2) >= 100*time.Millisecond && policy.backoff(2) <= 200*time.Millisecond)
+		assert.True(t, policy.backoff(5) >= 150*time.Millisecond && policy.backoff(5) <= 300*time.Millisecond)
+	}
+}
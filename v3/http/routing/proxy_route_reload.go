@@ -0,0 +1,102 @@
+package gl_routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// RouteTable returns the route table which is currently used for checking incoming requests.
+func (pc *ProxyClient) RouteTable() *RouteTable {
+	return pc.routeTable.Load().(*RouteTable)
+}
+
+// ReplaceRouteTable atomically swaps the route table of the proxy client.
+//
+// Requests which are already being handled finish against the previous table.
+// A nil table is rejected, reported through onErr and the previous table stays active.
+func (pc *ProxyClient) ReplaceRouteTable(routeTable *RouteTable) {
+	if routeTable == nil {
+		pc.reportErr(fmt.Errorf("route table reload rejected: route table is nil"), "")
+		return
+	}
+	pc.routeTable.Store(routeTable)
+}
+
+// ReloadRouteRules compiles input rules into a new route table and swaps it in.
+//
+// Rules which fail to compile are rejected, reported through onErr and the previous table stays active.
+func (pc *ProxyClient) ReloadRouteRules(routeRules []*ProxyRouteRule) error {
+	routeTable, err := NewProxyRouteTable(routeRules)
+	if err != nil {
+		err = fmt.Errorf("route table reload rejected: %s", err.Error())
+		pc.reportErr(err, "")
+		return err
+	}
+
+	pc.ReplaceRouteTable(routeTable)
+	return nil
+}
+
+// WatchRouteConfigFile polls the route config file at path (see LoadRouteConfigFile) with given interval
+// and swaps in a new route table whenever the file content changes.
+//
+// Only routes of the config are reloaded. Changes which fail to load are reported through onErr
+// and the previous table stays active.
+//
+// Polling runs in a separate goroutine until ctx is done.
+// It returns error if the file extension is not supported.
+func (pc *ProxyClient) WatchRouteConfigFile(ctx context.Context, path string, interval time.Duration) error {
+	format, err := routeConfigFileFormat(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastContent []byte
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				pc.reportErr(fmt.Errorf("unable to read route config file: '%s' error: %s", path, err.Error()), "")
+				continue
+			}
+
+			if bytes.Equal(content, lastContent) {
+				continue
+			}
+			lastContent = content
+
+			err = pc.reloadRouteConfig(content, format)
+			if err != nil {
+				pc.reportErr(fmt.Errorf("route table reload rejected: '%s' error: %s", path, err.Error()), "")
+			}
+		}
+	}()
+	return nil
+}
+
+func (pc *ProxyClient) reloadRouteConfig(content []byte, format RouteConfigFormat) error {
+	config, err := ParseRouteConfig(content, format)
+	if err != nil {
+		return err
+	}
+
+	routeTable, err := config.ProxyRouteTable()
+	if err != nil {
+		return err
+	}
+
+	pc.ReplaceRouteTable(routeTable)
+	return nil
+}
@@ -0,0 +1,141 @@
+package gl_routing
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUpgradeIdleTimeout is the error of UpgradeEvent when an upgraded connection was closed because it was idle.
+var ErrUpgradeIdleTimeout = errors.New("upgraded connection idle timeout")
+
+// UpgradeConfig defines how ProxyClient handles upgraded connections, e.g. WebSocket.
+type UpgradeConfig struct {
+	// IdleTimeout closes upgraded connections which have no traffic in either direction for the duration.
+	// Idle connections are not closed if it is zero.
+	IdleTimeout time.Duration
+	// OnConnection receives an event when an upgraded connection is opened and another one when it is closed.
+	OnConnection func(event *UpgradeEvent)
+}
+
+// UpgradeEvent describes an upgraded connection spliced between client and upstream.
+type UpgradeEvent struct {
+	SessionID string
+	// Protocol is the value of the Upgrade header, e.g. 'websocket'.
+	Protocol string
+	// Upstream is the URL of the upgrade request sent to upstream.
+	Upstream string
+	Closed   bool
+
+	// Following fields are only set for close events.
+	Duration time.Duration
+	// BytesSent is the number of bytes sent from client to upstream.
+	BytesSent int64
+	// BytesReceived is the number of bytes sent from upstream to client.
+	BytesReceived int64
+	// Err is ErrUpgradeIdleTimeout if the connection was closed because it was idle.
+	Err error
+}
+
+// upgradedConn wraps the upstream side of an upgraded connection.
+//
+// httputil.ReverseProxy hijacks the client connection and copies data in both directions through it,
+// therefore every byte of the connection passes through Read or Write.
+type upgradedConn struct {
+	io.ReadWriteCloser
+
+	config UpgradeConfig
+	event  UpgradeEvent
+	start  time.Time
+
+	sent     int64
+	received int64
+	idle     int32
+
+	// mu guards timer, the idle callback can run before newUpgradedConn has assigned it.
+	mu        sync.Mutex
+	timer     *time.Timer
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newUpgradedConn(conn io.ReadWriteCloser, config UpgradeConfig, event UpgradeEvent) *upgradedConn {
+	c := &upgradedConn{
+		ReadWriteCloser: conn,
+		config:          config,
+		event:           event,
+		start:           time.Now(),
+	}
+
+	if config.IdleTimeout > 0 {
+		c.mu.Lock()
+		c.timer = time.AfterFunc(config.IdleTimeout, func() {
+			atomic.StoreInt32(&c.idle, 1)
+			c.Close()
+		})
+		c.mu.Unlock()
+	}
+
+	if config.OnConnection != nil {
+		opened := c.event
+		config.OnConnection(&opened)
+	}
+	return c
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		atomic.AddInt64(&c.received, int64(n))
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *upgradedConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		atomic.AddInt64(&c.sent, int64(n))
+		c.touch()
+	}
+	return n, err
+}
+
+// touch postpones the idle timeout.
+func (c *upgradedConn) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Reset(c.config.IdleTimeout)
+	}
+}
+
+// Close closes the upstream connection, which makes ReverseProxy close the client connection as well.
+func (c *upgradedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		if c.timer != nil {
+			c.timer.Stop()
+			c.timer = nil
+		}
+		c.mu.Unlock()
+		c.closeErr = c.ReadWriteCloser.Close()
+
+		if c.config.OnConnection == nil {
+			return
+		}
+
+		closed := c.event
+		closed.Closed = true
+		closed.Duration = time.Since(c.start)
+		closed.BytesSent = atomic.LoadInt64(&c.sent)
+		closed.BytesReceived = atomic.LoadInt64(&c.received)
+		if atomic.LoadInt32(&c.idle) == 1 {
+			closed.Err = ErrUpgradeIdleTimeout
+		}
+		c.config.OnConnection(&closed)
+	})
+	return c.closeErr
+}
@@ -0,0 +1,160 @@
+package gl_routing
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoUpgradeServer creates an upstream which switches to a line based echo protocol.
+func newEchoUpgradeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\nX-Upstream: echo\r\n\r\n")
+		rw.Flush()
+
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString("echo: " + line)
+			rw.Flush()
+		}
+	}))
+}
+
+// dialUpgrade sends an upgrade request to path of server and returns the upgraded connection.
+func dialUpgrade(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, res
+}
+
+func Test_Proxy_Upgrade(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	events := make(chan *UpgradeEvent, 4)
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/notifications`).WithTimeout(10 * time.Millisecond),
+	}, upstream.URL, nil)
+	pc.SetUpgradeConfig(UpgradeConfig{OnConnection: func(event *UpgradeEvent) {
+		events <- event
+	}})
+
+	gateway := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer gateway.Close()
+
+	conn, reader, res := dialUpgrade(t, gateway, `/notifications`)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "echo", res.Header.Get("Upgrade"))
+
+	opened := <-events
+	assert.False(t, opened.Closed)
+	assert.Equal(t, "echo", opened.Protocol)
+	assert.Equal(t, upstream.URL+"/notifications", opened.Upstream)
+
+	// Route timeout does not apply to upgraded connections.
+	time.Sleep(30 * time.Millisecond)
+	for _, message := range []string{"hello\n", "world\n"} {
+		io.WriteString(conn, message)
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "echo: "+message, line)
+	}
+	conn.Close()
+
+	select {
+	case closed := <-events:
+		assert.True(t, closed.Closed)
+		assert.Equal(t, opened.SessionID, closed.SessionID)
+		assert.Equal(t, int64(12), closed.BytesSent)
+		assert.Equal(t, int64(24), closed.BytesReceived)
+		assert.NoError(t, closed.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("close event was not reported")
+	}
+
+	// Upgrade requests must pass the route table check as well.
+	conn, _, res = dialUpgrade(t, gateway, `/admin`)
+	defer conn.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func Test_Proxy_Upgrade_Response_Allow_List(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/notifications`)}, upstream.URL, nil)
+	pc.SetHeaderPolicy(HeaderPolicy{ResponseAllowList: []string{"Content-Type"}})
+
+	gateway := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer gateway.Close()
+
+	conn, reader, res := dialUpgrade(t, gateway, `/notifications`)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "echo", res.Header.Get("Upgrade"))
+	assert.Empty(t, res.Header.Get("X-Upstream"))
+
+	io.WriteString(conn, "hello\n")
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+}
+
+func Test_Proxy_Upgrade_Idle_Timeout(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	events := make(chan *UpgradeEvent, 2)
+	pc := newTestProxyClient(t, []*ProxyRouteRule{NewProxyRouteRule(`GET`, `/notifications`)}, upstream.URL, nil)
+	pc.SetUpgradeConfig(UpgradeConfig{IdleTimeout: 50 * time.Millisecond, OnConnection: func(event *UpgradeEvent) {
+		events <- event
+	}})
+
+	gateway := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer gateway.Close()
+
+	conn, reader, res := dialUpgrade(t, gateway, `/notifications`)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	<-events
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+
+	closed := <-events
+	assert.True(t, closed.Closed)
+	assert.Equal(t, ErrUpgradeIdleTimeout, closed.Err)
+}
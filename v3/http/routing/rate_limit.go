@@ -0,0 +1,287 @@
+package gl_routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gl_http "github.com/payports/golib/v3/http"
+)
+
+// RateLimit allows Requests per Period with bursts of up to Burst requests (token bucket).
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	// Burst is the capacity of the bucket. Requests is used if it is lower than 1.
+	Burst int
+}
+
+// ParseRateLimit parses limits in '<requests>/<period>' format, e.g. '100/1m' or '5/1s'.
+func ParseRateLimit(s string) (RateLimit, error) {
+	sep := strings.IndexByte(s, '/')
+	if sep < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit must be in '<requests>/<period>' format: '%s'", s)
+	}
+
+	requests, err := strconv.Atoi(s[:sep])
+	if err != nil || requests < 1 {
+		return RateLimit{}, fmt.Errorf("invalid request count of rate limit: '%s'", s)
+	}
+
+	period, err := time.ParseDuration(s[sep+1:])
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period of rate limit: '%s'", s)
+	}
+	return RateLimit{Requests: requests, Period: period}, nil
+}
+
+func (l RateLimit) capacity() int {
+	if l.Burst < 1 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+func (l RateLimit) isZero() bool {
+	return l.Requests < 1 || l.Period <= 0
+}
+
+// RateLimitResult is the outcome of consuming a request from a rate limit.
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero if this one was allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps rate limit state of keys.
+//
+// Take must refill and consume the bucket of a key in a single atomic step, otherwise concurrent requests,
+// possibly handled by other gateway instances sharing the store, can consume the same token.
+// A Redis backed store can do so with a Lua script. Requests are let through when Take returns error.
+type RateLimitStore interface {
+	// Take consumes a request of key's bucket with input limit.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore is a RateLimitStore which keeps token buckets in memory.
+// Buckets which are full again are removed periodically.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// Time at which the bucket is full again.
+	full time.Time
+}
+
+// NewMemoryRateLimitStore creates an in-memory store.
+// Every gateway instance limits its own requests, so a key can send up to the limit to each instance.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// Take consumes a request of key's bucket with input limit.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now, limit.Period)
+
+	capacity := float64(limit.capacity())
+	// Tokens per second.
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		s.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	result := RateLimitResult{Limit: limit.capacity()}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = secondsToDuration((capacity - bucket.tokens) / rate)
+	bucket.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep removes full buckets at most once per period. Must be called while holding mu.
+func (s *MemoryRateLimitStore) sweep(now time.Time, period time.Duration) {
+	if now.Sub(s.lastSweep) < period {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimitKeyFunc returns the client key which requests are limited by.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByHeader limits requests by the value of input header, e.g. an API key header.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimitByCookie limits requests by the value of input cookie, e.g. a session cookie.
+func RateLimitByCookie(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// RateLimitByClientIP limits requests by the IP address of the client connection.
+func RateLimitByClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimiterConfig defines the default limit and how clients are identified.
+type RateLimiterConfig struct {
+	Limit RateLimit
+	// Key identifies clients. Requests for which it returns an empty string are limited by client IP.
+	// RateLimitByClientIP is used if it is nil.
+	Key RateLimitKeyFunc
+	// Store keeps the limit state. A MemoryRateLimitStore is used if it is nil.
+	Store RateLimitStore
+}
+
+// RateLimiter enforces per client rate limits on ProxyClient (see SetRateLimiter) and Router (see Middleware).
+//
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// Limited requests are answered with 429 and a Retry-After header.
+// Requests are allowed when the store fails.
+type RateLimiter struct {
+	config         RateLimiterConfig
+	responseWriter responseWriter
+}
+
+// NewRateLimiter creates a rate limiter with input config.
+//
+// It will return error upon invalid data.
+func NewRateLimiter(config RateLimiterConfig) (*RateLimiter, error) {
+	if config.Limit.isZero() {
+		return nil, fmt.Errorf("rate limit requires positive requests and period")
+	}
+	if config.Key == nil {
+		config.Key = RateLimitByClientIP
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	return &RateLimiter{config: config, responseWriter: gl_http.NewResponseWriter()}, nil
+}
+
+// take consumes a request of r's client.
+//
+// Route limits are tracked separately for each route, a zero limit consumes from the default limit.
+func (l *RateLimiter) take(r *http.Request, method, path string, limit RateLimit) (RateLimitResult, error) {
+	key := l.config.Key(r)
+	if key == "" {
+		key = "ip:" + RateLimitByClientIP(r)
+	}
+
+	if limit.isZero() {
+		limit = l.config.Limit
+	} else {
+		key = "route:" + method + " " + path + "|" + key
+	}
+	return l.config.Store.Take(r.Context(), key, limit)
+}
+
+// Middleware limits requests of a Router with the default limit.
+//
+// onErr receives store errors and can be nil.
+func (l *RateLimiter) Middleware(onErr func(error, string)) Middleware {
+	return l.RouteMiddleware(RateLimit{}, onErr)
+}
+
+// RouteMiddleware limits requests with input limit, which is tracked separately for each matched route.
+// It can be registered to RouteRule.Middlewares to override the limit of a route.
+//
+// onErr receives store errors and can be nil.
+func (l *RateLimiter) RouteMiddleware(limit RateLimit, onErr func(error, string)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path := "", ""
+			if match := RouteMatchFromContext(r.Context()); match != nil {
+				method, path = match.Rule.Method, match.Rule.Path
+			}
+
+			result, err := l.take(r, method, path, limit)
+			if err != nil {
+				if onErr != nil {
+					onErr(fmt.Errorf("rate limit store error: %s", err.Error()), SessionID(r))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w.Header(), result)
+			if !result.Allowed {
+				l.responseWriter.WriteCustomJsonResponse(w, http.StatusTooManyRequests, map[string]interface{}{
+					"message": "too many requests",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders sets RateLimit-* headers (draft-ietf-httpapi-ratelimit-headers) and Retry-After.
+func setRateLimitHeaders(header http.Header, result RateLimitResult) {
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
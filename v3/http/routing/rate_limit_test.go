@@ -0,0 +1,165 @@
+package gl_routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Memory_Rate_Limit_Store(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	limit := RateLimit{Requests: 2, Period: time.Second, Burst: 3}
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(context.Background(), "key", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := store.Take(context.Background(), "key", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// Other keys have their own buckets.
+	result, _ = store.Take(context.Background(), "other", limit)
+	assert.True(t, result.Allowed)
+
+	// Tokens are refilled with Requests/Period rate.
+	now = now.Add(500 * time.Millisecond)
+	result, _ = store.Take(context.Background(), "key", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// Full buckets are removed.
+	now = now.Add(time.Minute)
+	store.Take(context.Background(), "key", limit)
+	assert.Len(t, store.buckets, 1)
+}
+
+func Test_Parse_Rate_Limit(t *testing.T) {
+	limit, err := ParseRateLimit("100/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Requests: 100, Period: time.Minute}, limit)
+
+	for _, s := range []string{"100", "0/1m", "x/1m", "100/0s", "100/minute"} {
+		_, err := ParseRateLimit(s)
+		assert.Error(t, err, s)
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store is down")
+}
+
+func Test_Proxy_Rate_Limit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	var errs []error
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/accounts`),
+		NewProxyRouteRule(`GET`, `/api/reports`).WithRateLimit(RateLimit{Requests: 1, Period: time.Hour}),
+	}, upstream.URL, func(err error, sessionID string) {
+		errs = append(errs, err)
+	})
+
+	limiter, err := NewRateLimiter(RateLimiterConfig{
+		Limit: RateLimit{Requests: 2, Period: time.Hour},
+		Key:   RateLimitByHeader("X-Api-Key"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.SetRateLimiter(limiter)
+
+	send := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(`GET`, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+		return rec
+	}
+
+	rec := send(`/api/accounts`, "partner-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1800", rec.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`, "partner-1").Code)
+
+	rec = send(`/api/accounts`, "partner-1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1800", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"message":"too many requests"`)
+
+	// Route limits and other clients are tracked separately.
+	assert.Equal(t, http.StatusOK, send(`/api/reports`, "partner-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(`/api/reports`, "partner-1").Code)
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`, "partner-2").Code)
+
+	// Requests without a key are limited by client IP.
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`, "").Code)
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(`/api/accounts`, "").Code)
+	assert.Len(t, errs, 3)
+
+	// Store errors do not block requests.
+	limiter, _ = NewRateLimiter(RateLimiterConfig{Limit: RateLimit{Requests: 1, Period: time.Hour}, Store: failingRateLimitStore{}})
+	pc.SetRateLimiter(limiter)
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`, "").Code)
+	assert.EqualError(t, errs[len(errs)-1], "rate limit store error: store is down")
+}
+
+func Test_Router_Rate_Limit(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterConfig{Limit: RateLimit{Requests: 1, Period: time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+		w.Write([]byte("ok"))
+	}
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, RouteTo: ok, Middlewares: []Middleware{limiter.Middleware(nil)}},
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true, RouteTo: ok, Middlewares: []Middleware{
+			limiter.RouteMiddleware(RateLimit{Requests: 2, Period: time.Minute}, nil),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(`GET`, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send(`/api/accounts`).Code)
+	rec := send(`/api/accounts`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, `{"message":"too many requests"}`, rec.Body.String())
+
+	// Route limit is shared by every path of the route.
+	assert.Equal(t, http.StatusOK, send(`/api/transfers/1`).Code)
+	assert.Equal(t, http.StatusOK, send(`/api/transfers/2`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(`/api/transfers/3`).Code)
+}
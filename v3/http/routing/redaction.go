@@ -0,0 +1,471 @@
+package gl_routing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gl_strings "github.com/payports/golib/v3/strings"
+)
+
+// MaskFunc transforms a sensitive value into its redacted form.
+type MaskFunc func(value string) string
+
+// MaskAll replaces every character of value with '*'.
+func MaskAll(value string) string {
+	return strings.Repeat("*", len([]rune(value)))
+}
+
+// MaskPAN keeps the first 6 and the last 4 characters of a card number and masks the rest with '*'.
+// Values too short to be a card number are masked completely.
+func MaskPAN(value string) string {
+	length := len([]rune(value))
+	if length <= 10 {
+		return MaskAll(value)
+	}
+	return gl_strings.MaskRange(value, 6, length-5, '*')
+}
+
+// RedactionRule selects sensitive data and the mask applied to it. Exactly one selector must be set.
+type RedactionRule struct {
+	// JSONPath selects fields of JSON bodies, e.g. '$.card.number', 'items[*].pan', '$..password' (any depth).
+	// Paths with a single key (e.g. 'password' or '$..password') also select fields of form-encoded bodies and query strings.
+	JSONPath string
+	// Header selects request and response headers. A trailing '*' matches a prefix, e.g. 'X-Secret-*'.
+	Header string
+	// Pattern selects regex matches in bodies of any content type, paths and query strings.
+	Pattern string
+
+	// Mask transforms selected values. MaskAll is used if it is nil.
+	Mask MaskFunc
+}
+
+// Redactor masks sensitive data of ProxyEvent instances and payloads.
+type Redactor struct {
+	paths    []*jsonPathRule
+	headers  []*headerRule
+	patterns []*patternRule
+}
+
+type jsonPathRule struct {
+	steps []jsonPathStep
+	mask  MaskFunc
+	// Matches the last key of the path in bodies which can not be parsed, e.g. truncated JSON.
+	fallback *regexp.Regexp
+}
+
+type headerRule struct {
+	matcher *headerMatcher
+	mask    MaskFunc
+}
+
+type patternRule struct {
+	regexp *regexp.Regexp
+	mask   MaskFunc
+}
+
+// NewRedactor creates a redactor from input rules.
+//
+// It will return error upon invalid data.
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{}
+
+	for i, rule := range rules {
+		mask := rule.Mask
+		if mask == nil {
+			mask = MaskAll
+		}
+
+		selectors := 0
+		if rule.JSONPath != "" {
+			selectors++
+			steps, err := parseJSONPath(rule.JSONPath)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON path of redaction rule %d: %s", i, err.Error())
+			}
+			r.paths = append(r.paths, &jsonPathRule{steps: steps, mask: mask, fallback: jsonFieldFallback(steps)})
+		}
+		if rule.Header != "" {
+			selectors++
+			r.headers = append(r.headers, &headerRule{matcher: newHeaderMatcher([]string{rule.Header}), mask: mask})
+		}
+		if rule.Pattern != "" {
+			selectors++
+			compiled, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of redaction rule %d: %s", i, err.Error())
+			}
+			r.patterns = append(r.patterns, &patternRule{regexp: compiled, mask: mask})
+		}
+
+		if selectors != 1 {
+			return nil, fmt.Errorf("redaction rule %d must have exactly one of JSONPath, Header or Pattern", i)
+		}
+	}
+	return r, nil
+}
+
+// RedactEvent masks headers, bodies, paths, query strings and the error of input event in place.
+func (r *Redactor) RedactEvent(event *ProxyEvent) {
+	event.Path = r.redactPatterns(event.Path)
+	event.RawQuery = r.RedactQuery(event.RawQuery)
+	event.RequestBody = r.RedactBody(event.RequestBody, event.RequestHeader)
+	event.ResponseBody = r.RedactBody(event.ResponseBody, event.ResponseHeader)
+	event.RequestHeader = r.RedactHeader(event.RequestHeader)
+	event.ResponseHeader = r.RedactHeader(event.ResponseHeader)
+	event.Err = r.RedactError(event.Err)
+
+	if upstream, err := url.Parse(event.Upstream); err == nil && event.Upstream != "" {
+		upstream.RawQuery = r.RedactQuery(upstream.RawQuery)
+		event.Upstream = r.redactPatterns(upstream.String())
+	}
+}
+
+// RedactHeader returns a copy of input header with selected values masked.
+func (r *Redactor) RedactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	redacted := header.Clone()
+	for name, values := range redacted {
+		for _, rule := range r.headers {
+			if !rule.matcher.matches(name) {
+				continue
+			}
+			for i := range values {
+				values[i] = rule.mask(values[i])
+			}
+		}
+	}
+	return redacted
+}
+
+// RedactQuery masks selected fields and pattern matches of an url encoded query string.
+func (r *Redactor) RedactQuery(rawQuery string) string {
+	return r.redactPatterns(r.redactForm(rawQuery))
+}
+
+// RedactBody returns input body with selected data masked.
+//
+// JSON and form-encoded bodies are recognized from Content-Type of header.
+// Gzip compressed bodies are decompressed and returned uncompressed.
+// JSON bodies which can not be parsed (e.g. truncated captures) are redacted by field name.
+func (r *Redactor) RedactBody(body []byte, header http.Header) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	if isGzip(body) {
+		decompressed, err := gunzip(body)
+		if err != nil {
+			// Compressed data can not leak any selected values in a readable form.
+			return body
+		}
+		body = decompressed
+	}
+
+	contentType := ""
+	if header != nil {
+		contentType, _, _ = mime.ParseMediaType(header.Get("Content-Type"))
+	}
+
+	text := string(body)
+	switch {
+	case contentType == "application/x-www-form-urlencoded":
+		text = r.redactForm(text)
+	case strings.HasSuffix(contentType, "json") || looksLikeJSON(body):
+		text = r.redactJSON(body)
+	}
+	return []byte(r.redactPatterns(text))
+}
+
+func (r *Redactor) redactJSON(body []byte) string {
+	if len(r.paths) == 0 {
+		return string(body)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil {
+		for _, rule := range r.paths {
+			value = applyJSONPath(value, rule.steps, rule.mask)
+		}
+		redacted := &bytes.Buffer{}
+		encoder := json.NewEncoder(redacted)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err == nil {
+			return strings.TrimSuffix(redacted.String(), "\n")
+		}
+	}
+
+	text := string(body)
+	for _, rule := range r.paths {
+		text = redactJSONFieldFallback(text, rule)
+	}
+	return text
+}
+
+// redactForm masks form fields selected by single key JSON paths.
+func (r *Redactor) redactForm(form string) string {
+	if form == "" || len(r.paths) == 0 {
+		return form
+	}
+
+	pairs := strings.Split(form, "&")
+	for i, pair := range pairs {
+		sep := strings.IndexByte(pair, '=')
+		if sep < 0 {
+			continue
+		}
+
+		key, err := url.QueryUnescape(pair[:sep])
+		if err != nil {
+			continue
+		}
+		value, err := url.QueryUnescape(pair[sep+1:])
+		if err != nil {
+			value = pair[sep+1:]
+		}
+
+		for _, rule := range r.paths {
+			if rule.matchesFormKey(key) {
+				// Masks are kept readable, '*' does not need escaping in query strings.
+				pairs[i] = pair[:sep+1] + strings.ReplaceAll(url.QueryEscape(rule.mask(value)), "%2A", "*")
+				break
+			}
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactError masks pattern matches of the message of input error.
+// Errors which do not contain any match are returned as they are.
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	if redacted := r.redactPatterns(message); redacted != message {
+		return &redactedError{message: redacted, err: err}
+	}
+	return err
+}
+
+func (r *Redactor) redactPatterns(text string) string {
+	for _, rule := range r.patterns {
+		text = rule.regexp.ReplaceAllStringFunc(text, rule.mask)
+	}
+	return text
+}
+
+func isGzip(body []byte) bool {
+	return len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b
+}
+
+func gunzip(body []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	decompressed, err := ioutil.ReadAll(reader)
+	// Truncated captures end with an unexpected EOF, whatever was decompressed until then is still redacted.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return decompressed, nil
+}
+
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+type jsonPathStepKind int
+
+const (
+	jsonPathKey jsonPathStepKind = iota
+	jsonPathWildcard
+	jsonPathIndex
+)
+
+// jsonPathStep is a single step of a parsed JSON path.
+type jsonPathStep struct {
+	kind  jsonPathStepKind
+	key   string
+	index int
+	// Matches the key at any depth below the current value.
+	recursive bool
+}
+
+// parseJSONPath parses paths like '$.card.number', 'items[*].pan', 'items[0]', '$.*.token' or '$..password'.
+// The leading '$.' can be omitted.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		rest = "." + rest
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed index in path: '%s'", path)
+			}
+
+			index := rest[1:end]
+			if index == "*" {
+				steps = append(steps, jsonPathStep{kind: jsonPathWildcard})
+			} else {
+				n, err := strconv.Atoi(index)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index: '%s' in path: '%s'", index, path)
+				}
+				steps = append(steps, jsonPathStep{kind: jsonPathIndex, index: n})
+			}
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			step := jsonPathStep{kind: jsonPathKey}
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				step.recursive = true
+				rest = rest[1:]
+			}
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			step.key = rest[:end]
+			rest = rest[end:]
+
+			if step.key == "" {
+				return nil, fmt.Errorf("empty key in path: '%s'", path)
+			}
+			if step.key == "*" {
+				if step.recursive {
+					return nil, fmt.Errorf("recursive wildcard is not supported in path: '%s'", path)
+				}
+				step.kind = jsonPathWildcard
+			}
+			steps = append(steps, step)
+		default:
+			return nil, fmt.Errorf("unexpected character: '%c' in path: '%s'", rest[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// applyJSONPath masks values of input decoded JSON value which are selected by steps.
+func applyJSONPath(value interface{}, steps []jsonPathStep, mask MaskFunc) interface{} {
+	if len(steps) == 0 {
+		return maskJSONValue(value, mask)
+	}
+
+	step, rest := steps[0], steps[1:]
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			switch {
+			case step.kind == jsonPathWildcard, step.kind == jsonPathKey && step.key == key:
+				v[key] = applyJSONPath(child, rest, mask)
+				if step.recursive && len(rest) > 0 {
+					v[key] = applyJSONPath(v[key], steps, mask)
+				}
+			case step.recursive:
+				v[key] = applyJSONPath(child, steps, mask)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			switch {
+			case step.kind == jsonPathWildcard, step.kind == jsonPathIndex && step.index == i:
+				v[i] = applyJSONPath(child, rest, mask)
+			case step.recursive:
+				v[i] = applyJSONPath(child, steps, mask)
+			}
+		}
+	}
+	return value
+}
+
+// maskJSONValue masks scalar values. Objects and arrays keep their structure and all their scalars are masked.
+func maskJSONValue(value interface{}, mask MaskFunc) interface{} {
+	switch v := value.(type) {
+	case string:
+		return mask(v)
+	case json.Number:
+		return mask(v.String())
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = maskJSONValue(child, mask)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = maskJSONValue(child, mask)
+		}
+	}
+	return value
+}
+
+// matchesFormKey returns true if the path selects input key of a form-encoded body.
+func (rule *jsonPathRule) matchesFormKey(key string) bool {
+	return len(rule.steps) == 1 && rule.steps[0].kind == jsonPathKey && rule.steps[0].key == key
+}
+
+// jsonFieldFallback creates a regex which matches string and number values of the last key of steps.
+// Unterminated strings are matched as well, since they are the typical end of truncated bodies.
+func jsonFieldFallback(steps []jsonPathStep) *regexp.Regexp {
+	last := steps[len(steps)-1]
+	if last.kind != jsonPathKey {
+		return nil
+	}
+	return regexp.MustCompile(`"` + regexp.QuoteMeta(last.key) + `"\s*:\s*(?:"((?:[^"\\]|\\.)*)"?|(-?[0-9][0-9.eE+-]*))`)
+}
+
+func redactJSONFieldFallback(text string, rule *jsonPathRule) string {
+	if rule.fallback == nil {
+		return text
+	}
+
+	return rule.fallback.ReplaceAllStringFunc(text, func(match string) string {
+		groups := rule.fallback.FindStringSubmatchIndex(match)
+		for g := 1; g <= 2; g++ {
+			start, end := groups[2*g], groups[2*g+1]
+			if start >= 0 {
+				return match[:start] + rule.mask(match[start:end]) + match[end:]
+			}
+		}
+		return match
+	})
+}
+
+// redactedError replaces the message of an error while keeping it unwrappable.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,163 @@
+package gl_routing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedactor(t *testing.T) *Redactor {
+	redactor, err := NewRedactor([]RedactionRule{
+		{JSONPath: `$.card.number`, Mask: MaskPAN},
+		{JSONPath: `items[*].cvv`},
+		{JSONPath: `$..password`},
+		{Header: `Authorization`},
+		{Header: `X-Secret-*`},
+		{Pattern: `\b4[0-9]{15}\b`, Mask: MaskPAN},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redactor
+}
+
+func Test_Mask_Functions(t *testing.T) {
+	assert.Equal(t, "411111******1111", MaskPAN("4111111111111111"))
+	assert.Equal(t, "*****", MaskPAN("12345"))
+	assert.Equal(t, "****", MaskAll("pass"))
+}
+
+func Test_Redact_Body(t *testing.T) {
+	redactor := newTestRedactor(t)
+	jsonHeader := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	formHeader := http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}}
+
+	type testData struct {
+		name     string
+		body     string
+		header   http.Header
+		expected string
+	}
+
+	data := []testData{
+		{
+			name:     "json paths",
+			body:     `{"card":{"number":"4111111111111111","holder":"J <D>"},"items":[{"cvv":123},{"cvv":"456"}],"user":{"password":"secret"}}`,
+			header:   jsonHeader,
+			expected: `{"card":{"holder":"J <D>","number":"411111******1111"},"items":[{"cvv":"***"},{"cvv":"***"}],"user":{"password":"******"}}`,
+		},
+		{
+			name:     "selected objects keep their structure",
+			body:     `{"password":{"old":"a","new":"bc"}}`,
+			header:   nil,
+			expected: `{"password":{"new":"**","old":"*"}}`,
+		},
+		{
+			name:     "truncated json",
+			body:     `{"user":{"password":"sec`,
+			header:   jsonHeader,
+			expected: `{"user":{"password":"***`,
+		},
+		{
+			name:     "form",
+			body:     `user=john&password=p%40ss&note=card+4111111111111111`,
+			header:   formHeader,
+			expected: `user=john&password=****&note=card+411111******1111`,
+		},
+		{
+			name:     "plain text patterns",
+			body:     `card: 4111111111111111, password: secret`,
+			header:   http.Header{"Content-Type": []string{"text/plain"}},
+			expected: `card: 411111******1111, password: secret`,
+		},
+	}
+
+	for _, td := range data {
+		assert.Equal(t, td.expected, string(redactor.RedactBody([]byte(td.body), td.header)), td.name)
+	}
+
+	compressed := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(compressed)
+	gzipWriter.Write([]byte(`{"user":{"password":"secret"}}`))
+	gzipWriter.Close()
+	assert.Equal(t, `{"user":{"password":"******"}}`, string(redactor.RedactBody(compressed.Bytes(), jsonHeader)))
+}
+
+func Test_Redact_Header_And_Query(t *testing.T) {
+	redactor := newTestRedactor(t)
+
+	header := http.Header{
+		"Authorization": []string{"Bearer abc"},
+		"X-Secret-Key":  []string{"key"},
+		"Accept":        []string{"*/*"},
+	}
+	redacted := redactor.RedactHeader(header)
+	assert.Equal(t, "**********", redacted.Get("Authorization"))
+	assert.Equal(t, "***", redacted.Get("X-Secret-Key"))
+	assert.Equal(t, "*/*", redacted.Get("Accept"))
+	// Input header is not changed.
+	assert.Equal(t, "Bearer abc", header.Get("Authorization"))
+
+	assert.Equal(t, "password=******&pan=411111******1111", redactor.RedactQuery("password=secret&pan=4111111111111111"))
+
+	err := redactor.RedactError(fmt.Errorf("path is not allowed: /cards/4111111111111111"))
+	assert.EqualError(t, err, "path is not allowed: /cards/411111******1111")
+}
+
+func Test_Invalid_Redaction_Rules(t *testing.T) {
+	type testData struct {
+		rule RedactionRule
+		err  string
+	}
+
+	data := []testData{
+		{rule: RedactionRule{}, err: `redaction rule 0 must have exactly one of JSONPath, Header or Pattern`},
+		{rule: RedactionRule{JSONPath: `a`, Header: `b`}, err: `redaction rule 0 must have exactly one of JSONPath, Header or Pattern`},
+		{rule: RedactionRule{JSONPath: `items[x]`}, err: `invalid JSON path of redaction rule 0: invalid index: 'x' in path: 'items[x]'`},
+		{rule: RedactionRule{JSONPath: `$.a..`}, err: `invalid JSON path of redaction rule 0: empty key in path: '$.a..'`},
+		{rule: RedactionRule{Pattern: `[0-9`}, err: "invalid pattern of redaction rule 0: error parsing regexp: missing closing ]: `[0-9`"},
+	}
+
+	for _, td := range data {
+		_, err := NewRedactor([]RedactionRule{td.rule})
+		assert.EqualError(t, err, td.err)
+	}
+}
+
+func Test_Proxy_Redaction(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"card":{"number":"4111111111111111"}}`))
+	}))
+	defer upstream.Close()
+
+	var reqBodies, resBodies []string
+	var errs []string
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`POST`, `/api/payments`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := NewProxyClient(routeTable, upstream.URL, http.DefaultClient, nil, nil, func(err error, sessionID string) {
+		errs = append(errs, err.Error())
+	}, func(body []byte, sessionID string) {
+		reqBodies = append(reqBodies, string(body))
+	}, func(body []byte, sessionID string) {
+		resBodies = append(resBodies, string(body))
+	})
+	pc.SetRedactor(newTestRedactor(t))
+
+	req := httptest.NewRequest(`POST`, `/api/payments`, strings.NewReader(`{"card":{"number":"4111111111111111"},"password":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	pc.HandleRequestAndRedirect(httptest.NewRecorder(), req)
+	pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/cards/4111111111111111`, nil))
+
+	assert.Equal(t, []string{`{"card":{"number":"411111******1111"},"password":"*"}`}, reqBodies)
+	assert.Equal(t, `{"card":{"number":"411111******1111"}}`, resBodies[0])
+	assert.Equal(t, []string{"path is not allowed: /cards/411111******1111"}, errs)
+}
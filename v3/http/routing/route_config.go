@@ -0,0 +1,472 @@
+package gl_routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type RouteConfigFormat int
+
+const (
+	RouteConfigJSON RouteConfigFormat = iota + 1
+	RouteConfigYAML
+)
+
+// RouteConfig is a route table definition loaded from a JSON or YAML document.
+//
+// Example YAML document:
+//
+//	ignoredPaths:
+//	  - /health
+//	routes:
+//	  - name: transfer.get
+//	    methods: [GET]
+//	    path: /api/transfers/{guid}
+//	    handler: getTransfer
+//	    auth: tokenAuth
+//
+// Proxy route tables can override upstream settings per route:
+//
+//	routes:
+//	  - methods: [GET, POST]
+//	    path: /payments/{id}
+//	    upstream: http://payments.internal
+//	    stripPrefix: /payments
+//	    rewritePrefix: /api/v2/payments
+//	    timeout: 5s
+//	    rateLimit: 100/1m
+//	    cacheTTL: 10m
+//
+// The same structure is used for JSON documents.
+type RouteConfig struct {
+	Routes       []*RouteConfigEntry
+	IgnoredPaths []string
+}
+
+// RouteConfigEntry is a single route definition of RouteConfig.
+type RouteConfigEntry struct {
+	Name    string   `yaml:"name"`
+	Methods []string `yaml:"methods"`
+	Path    string   `yaml:"path"`
+	// Handler is the name of the RouteTo function registered to RouteHandlers. Only used for Router.
+	Handler string `yaml:"handler"`
+	// Auth is the name of the AuthWith function registered to RouteHandlers. Only used for Router.
+	Auth string `yaml:"auth"`
+
+	// Upstream overrides the default URL of ProxyClient. Only used for RouteTable.
+	Upstream string `yaml:"upstream"`
+	// StripPrefix is removed from the request path before it is forwarded. Only used for RouteTable.
+	StripPrefix string `yaml:"stripPrefix"`
+	// RewritePrefix replaces StripPrefix when it is defined. Only used for RouteTable.
+	RewritePrefix string `yaml:"rewritePrefix"`
+	// Timeout overrides the timeout of ProxyClient, e.g. '5s'. Only used for RouteTable.
+	Timeout string `yaml:"timeout"`
+	// RateLimit overrides the default limit of the rate limiter of ProxyClient, e.g. '100/1m'. Only used for RouteTable.
+	RateLimit string `yaml:"rateLimit"`
+	// CacheTTL overrides the freshness lifetime of cached GET responses, e.g. '10m'. Negative values disable caching.
+	// Only used for RouteTable.
+	CacheTTL string `yaml:"cacheTTL"`
+
+	// Line of the entry in the source document.
+	Line int `yaml:"-"`
+
+	// Lines of the entry fields in the source document as key: field name, value: line pairs.
+	fieldLines map[string]int
+	// Lines of Methods items, index aligned with Methods.
+	methodLines []int
+}
+
+// RouteHandlers is a registry of named functions which RouteConfig entries can refer to.
+type RouteHandlers struct {
+	RouteTo  map[string]func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string)
+	AuthWith map[string]func(sessionID string, w http.ResponseWriter, r *http.Request) error
+}
+
+var routeConfigEntryFields = map[string]bool{
+	"name": true, "methods": true, "path": true, "handler": true, "auth": true,
+	"upstream": true, "stripPrefix": true, "rewritePrefix": true, "timeout": true, "rateLimit": true,
+	"cacheTTL": true,
+}
+
+// LoadRouteConfigFile reads and parses the route config file at path.
+//
+// Format is determined from the file extension: '.json', '.yaml' or '.yml'.
+func LoadRouteConfigFile(path string) (*RouteConfig, error) {
+	format, err := routeConfigFileFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read route config file: '%s' error: %s", path, err.Error())
+	}
+	return ParseRouteConfig(data, format)
+}
+
+func routeConfigFileFormat(path string) (RouteConfigFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return RouteConfigJSON, nil
+	case ".yaml", ".yml":
+		return RouteConfigYAML, nil
+	}
+	return 0, fmt.Errorf("unsupported route config file extension: '%s'", path)
+}
+
+// ParseRouteConfig parses a route config document and validates its route paths.
+//
+// Every problem found is reported together in a single *RouteValidationError,
+// each problem is prefixed with the line it occurs on.
+func ParseRouteConfig(data []byte, format RouteConfigFormat) (*RouteConfig, error) {
+	if format == RouteConfigJSON {
+		// YAML parser also accepts JSON documents and provides line numbers for the nodes,
+		// however JSON syntax is validated separately to produce JSON specific error messages.
+		var doc interface{}
+		err := json.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, jsonSyntaxError(data, err)
+		}
+	} else if format != RouteConfigYAML {
+		return nil, fmt.Errorf("unsupported route config format: %d", format)
+	}
+
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse route config: %s", err.Error())
+	}
+
+	config := &RouteConfig{}
+	if len(root.Content) == 0 {
+		return config, nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: route config must be a mapping", doc.Line)
+	}
+
+	problems := make([]string, 0)
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+
+		switch key.Value {
+		case "routes":
+			config.Routes, problems = parseRouteConfigEntries(value, problems)
+		case "ignoredPaths":
+			err := value.Decode(&config.IgnoredPaths)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: invalid ignoredPaths: %s", value.Line, err.Error()))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("line %d: unknown field: '%s'", key.Line, key.Value))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &RouteValidationError{Problems: problems}
+	}
+	return config, nil
+}
+
+func parseRouteConfigEntries(node *yaml.Node, problems []string) ([]*RouteConfigEntry, []string) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, append(problems, fmt.Sprintf("line %d: routes must be a list", node.Line))
+	}
+
+	entries := make([]*RouteConfigEntry, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			problems = append(problems, fmt.Sprintf("line %d: route must be a mapping", item.Line))
+			continue
+		}
+
+		for i := 0; i < len(item.Content); i += 2 {
+			key := item.Content[i]
+			if !routeConfigEntryFields[key.Value] {
+				problems = append(problems, fmt.Sprintf("line %d: unknown route field: '%s'", key.Line, key.Value))
+			}
+		}
+
+		entry := &RouteConfigEntry{}
+		err := item.Decode(entry)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: invalid route: %s", item.Line, err.Error()))
+			continue
+		}
+		entry.Line = item.Line
+		entry.recordLines(item)
+
+		problems = append(problems, entry.validate()...)
+		entries = append(entries, entry)
+	}
+	return entries, problems
+}
+
+// recordLines stores lines of the fields of the entry, so that problems are reported on the line they occur on.
+func (e *RouteConfigEntry) recordLines(item *yaml.Node) {
+	e.fieldLines = make(map[string]int, len(item.Content)/2)
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		key, value := item.Content[i], item.Content[i+1]
+		e.fieldLines[key.Value] = value.Line
+
+		if key.Value == "methods" && value.Kind == yaml.SequenceNode {
+			e.methodLines = make([]int, len(value.Content))
+			for j, method := range value.Content {
+				e.methodLines[j] = method.Line
+			}
+		}
+	}
+}
+
+// lineOf returns the line of the named field, or the line of the entry if the field is not defined.
+func (e *RouteConfigEntry) lineOf(field string) int {
+	if line, ok := e.fieldLines[field]; ok {
+		return line
+	}
+	return e.Line
+}
+
+// methodLine returns the line of the method at index i of Methods.
+func (e *RouteConfigEntry) methodLine(i int) int {
+	if i < len(e.methodLines) {
+		return e.methodLines[i]
+	}
+	return e.lineOf("methods")
+}
+
+func (e *RouteConfigEntry) validate() []string {
+	problems := make([]string, 0)
+
+	if len(e.Methods) == 0 {
+		problems = append(problems, fmt.Sprintf("line %d: route has no methods", e.lineOf("methods")))
+	}
+	for i, method := range e.Methods {
+		if method == "" || strings.ToUpper(method) != method {
+			problems = append(problems, fmt.Sprintf("line %d: invalid method: '%s'", e.methodLine(i), method))
+		}
+	}
+
+	pathLine := e.lineOf("path")
+	if !strings.HasPrefix(e.Path, "/") {
+		problems = append(problems, fmt.Sprintf("line %d: path must start with '/': '%s'", pathLine, e.Path))
+		return problems
+	}
+
+	regexConv, err := RouteToRegExp(e.Path)
+	if err != nil {
+		return append(problems, fmt.Sprintf("line %d: invalid path definition: '%s' error: %s", pathLine, e.Path, err.Error()))
+	}
+
+	_, err = regexp.Compile(regexConv)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("line %d: can not compile: '%s': %s", pathLine, e.Path, err.Error()))
+	}
+
+	if e.Upstream != "" {
+		parsed, err := url.Parse(e.Upstream)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("line %d: upstream must be an absolute URL: '%s'", e.lineOf("upstream"), e.Upstream))
+		}
+	}
+
+	if e.RewritePrefix != "" && e.StripPrefix == "" {
+		problems = append(problems, fmt.Sprintf("line %d: rewritePrefix requires stripPrefix", e.lineOf("rewritePrefix")))
+	}
+
+	if e.Timeout != "" {
+		_, err = time.ParseDuration(e.Timeout)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: invalid timeout: '%s'", e.lineOf("timeout"), e.Timeout))
+		}
+	}
+
+	if e.RateLimit != "" {
+		_, err = ParseRateLimit(e.RateLimit)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %s", e.lineOf("rateLimit"), err.Error()))
+		}
+	}
+
+	if e.CacheTTL != "" {
+		_, err = time.ParseDuration(e.CacheTTL)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: invalid cacheTTL: '%s'", e.lineOf("cacheTTL"), e.CacheTTL))
+		}
+	}
+	return problems
+}
+
+func (e *RouteConfigEntry) hasProxyOverrides() bool {
+	return e.Upstream != "" || e.StripPrefix != "" || e.RewritePrefix != "" || e.Timeout != "" || e.RateLimit != "" || e.CacheTTL != ""
+}
+
+// proxyOverridesLine returns the line of the first proxy override field of the entry.
+func (e *RouteConfigEntry) proxyOverridesLine() int {
+	line := 0
+	for _, field := range []string{"upstream", "stripPrefix", "rewritePrefix", "timeout", "rateLimit", "cacheTTL"} {
+		if l, ok := e.fieldLines[field]; ok && (line == 0 || l < line) {
+			line = l
+		}
+	}
+	if line == 0 {
+		return e.Line
+	}
+	return line
+}
+
+// handlersLine returns the line of the first handler or auth field of the entry.
+func (e *RouteConfigEntry) handlersLine() int {
+	if e.Handler != "" {
+		return e.lineOf("handler")
+	}
+	return e.lineOf("auth")
+}
+
+// ProxyRouteTable creates a RouteTable which allows every method and path pair of the config.
+//
+// Entries which refer to handlers are rejected, since RouteTable does not dispatch to handlers.
+func (c *RouteConfig) ProxyRouteTable() (*RouteTable, error) {
+	problems := make([]string, 0)
+	rules := make([]*ProxyRouteRule, 0, len(c.Routes))
+
+	for _, e := range c.Routes {
+		if e.Handler != "" || e.Auth != "" {
+			problems = append(problems, fmt.Sprintf("line %d: handler and auth are not supported for proxy routes", e.handlersLine()))
+			continue
+		}
+
+		// Timeout, rate limit and cache TTL were already validated by ParseRouteConfig.
+		timeout, _ := time.ParseDuration(e.Timeout)
+		cacheTTL, _ := time.ParseDuration(e.CacheTTL)
+		var rateLimit RateLimit
+		if e.RateLimit != "" {
+			rateLimit, _ = ParseRateLimit(e.RateLimit)
+		}
+
+		for _, method := range e.Methods {
+			rule := NewProxyRouteRule(method, e.Path).
+				WithUpstream(e.Upstream).
+				WithPathRewrite(e.StripPrefix, e.RewritePrefix).
+				WithTimeout(timeout).
+				WithRateLimit(rateLimit).
+				WithCacheTTL(cacheTTL)
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &RouteValidationError{Problems: problems}
+	}
+
+	table, err := NewProxyRouteTable(rules)
+	if err != nil {
+		return nil, &RouteValidationError{Problems: []string{err.Error()}}
+	}
+	return table, nil
+}
+
+// Router creates a Router from the config, resolving handler and auth names from input handlers.
+//
+// Entries with route parameters are registered as DynamicPath=true.
+// Every problem found, including route conflicts, is reported together in a single *RouteValidationError.
+func (c *RouteConfig) Router(handlers RouteHandlers) (*Router, error) {
+	router, err := NewRouter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]string, 0)
+	for _, e := range c.Routes {
+		if e.hasProxyOverrides() {
+			problems = append(problems, fmt.Sprintf("line %d: upstream, stripPrefix, rewritePrefix, timeout, rateLimit and cacheTTL are not supported for router routes", e.proxyOverridesLine()))
+		}
+
+		routeTo := handlers.RouteTo[e.Handler]
+		if e.Handler != "" && routeTo == nil {
+			problems = append(problems, fmt.Sprintf("line %d: unknown handler: '%s'", e.lineOf("handler"), e.Handler))
+		}
+
+		authWith := handlers.AuthWith[e.Auth]
+		if e.Auth != "" && authWith == nil {
+			problems = append(problems, fmt.Sprintf("line %d: unknown auth: '%s'", e.lineOf("auth"), e.Auth))
+		}
+
+		for i, method := range e.Methods {
+			// Route names are only used for building URLs, therefore it is enough to register the name once.
+			name := ""
+			if i == 0 {
+				name = e.Name
+			}
+
+			// Rules are added one by one so that conflicts can be reported with the line of the offending entry.
+			err := router.Add(&RouteRule{
+				Name:        name,
+				Method:      method,
+				Path:        e.Path,
+				DynamicPath: strings.Contains(e.Path, "{"),
+				AuthWith:    authWith,
+				RouteTo:     routeTo,
+			})
+			if err != nil {
+				problems = append(problems, prefixProblems(err, e.lineOf("path"))...)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &RouteValidationError{Problems: problems}
+	}
+	return router, nil
+}
+
+func prefixProblems(err error, line int) []string {
+	validationErr, ok := err.(*RouteValidationError)
+	if !ok {
+		return []string{fmt.Sprintf("line %d: %s", line, err.Error())}
+	}
+
+	problems := make([]string, len(validationErr.Problems))
+	for i, p := range validationErr.Problems {
+		problems[i] = fmt.Sprintf("line %d: %s", line, p)
+	}
+	return problems
+}
+
+// jsonSyntaxError converts offset of JSON decoding errors to line and column numbers.
+func jsonSyntaxError(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Errorf("unable to parse route config: %s", err.Error())
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	line, column := 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return fmt.Errorf("line %d column %d: unable to parse route config: %s", line, column, err.Error())
+}
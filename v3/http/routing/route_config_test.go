@@ -0,0 +1,195 @@
+package gl_routing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRouteConfigYAML = `
+ignoredPaths:
+  - /health
+routes:
+  - name: transfer.get
+    methods: [GET]
+    path: /api/transfers/{guid}
+    handler: getTransfer
+  - methods: [GET, POST]
+    path: /api/accounts
+`
+
+const testRouteConfigJSON = `{
+  "ignoredPaths": ["/health"],
+  "routes": [
+    {"name": "transfer.get", "methods": ["GET"], "path": "/api/transfers/{guid}", "handler": "getTransfer"},
+    {"methods": ["GET", "POST"], "path": "/api/accounts"}
+  ]
+}`
+
+func Test_Parse_Route_Config(t *testing.T) {
+	for format, data := range map[RouteConfigFormat]string{RouteConfigYAML: testRouteConfigYAML, RouteConfigJSON: testRouteConfigJSON} {
+		config, err := ParseRouteConfig([]byte(data), format)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, []string{"/health"}, config.IgnoredPaths)
+		if assert.Len(t, config.Routes, 2) {
+			assert.Equal(t, "transfer.get", config.Routes[0].Name)
+			assert.Equal(t, []string{"GET", "POST"}, config.Routes[1].Methods)
+		}
+
+		router, err := config.Router(RouteHandlers{
+			RouteTo: map[string]func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string){
+				"getTransfer": func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+					w.Write([]byte(routeParams["guid"]))
+				},
+			},
+		})
+		if assert.NoError(t, err) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/transfers/abc`, nil))
+			assert.Equal(t, "abc", rec.Body.String())
+
+			built, err := router.URL("transfer.get", map[string]string{"guid": "x"}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "/api/transfers/x", built)
+		}
+	}
+}
+
+func Test_Route_Config_Proxy_Route_Table(t *testing.T) {
+	config, err := ParseRouteConfig([]byte(`
+routes:
+  - methods: [GET, POST]
+    path: /api/accounts
+  - methods: [GET]
+    path: /api/transfers/{id:int}
+`), RouteConfigYAML)
+	assert.NoError(t, err)
+
+	table, err := config.ProxyRouteTable()
+	if assert.NoError(t, err) {
+		assert.Len(t, table.routeRules, 3)
+	}
+
+	config, err = ParseRouteConfig([]byte(`
+routes:
+  - methods: [GET]
+    path: /payments/{id}
+    upstream: http://payments.internal
+    stripPrefix: /payments
+    rewritePrefix: /api/v2/payments
+    timeout: 5s
+    rateLimit: 100/1m
+    cacheTTL: 10m
+`), RouteConfigYAML)
+	assert.NoError(t, err)
+
+	table, err = config.ProxyRouteTable()
+	if assert.NoError(t, err) {
+		rule := table.routeRules[0]
+		assert.Equal(t, "http://payments.internal", rule.Upstream())
+		assert.Equal(t, 5*time.Second, rule.Timeout())
+		assert.Equal(t, RateLimit{Requests: 100, Period: time.Minute}, rule.RateLimit())
+		assert.Equal(t, 10*time.Minute, rule.CacheTTL())
+		assert.Equal(t, "/api/v2/payments/1", rule.rewritePath("/payments/1"))
+	}
+
+	_, err = ParseRouteConfig([]byte(`
+routes:
+  - methods: [GET]
+    path: /payments
+    upstream: payments.internal
+    rewritePrefix: /api
+    timeout: soon
+    rateLimit: 100
+    cacheTTL: long
+`), RouteConfigYAML)
+	assert.EqualError(t, err, `invalid route rules: line 5: upstream must be an absolute URL: 'payments.internal'; line 6: rewritePrefix requires stripPrefix; line 7: invalid timeout: 'soon'; line 8: rate limit must be in '<requests>/<period>' format: '100'; line 9: invalid cacheTTL: 'long'`)
+
+	config, err = ParseRouteConfig([]byte(testRouteConfigYAML), RouteConfigYAML)
+	assert.NoError(t, err)
+
+	_, err = config.ProxyRouteTable()
+	assert.EqualError(t, err, `invalid route rules: line 8: handler and auth are not supported for proxy routes`)
+}
+
+func Test_Route_Config_Errors(t *testing.T) {
+	data := `
+routes:
+  - methods: [GET]
+    path: /api/transfers/{id
+  - methods: []
+    path: api/accounts
+  - methods: [get]
+    path: /api/x
+    target: somewhere
+unknown: true
+`
+	_, err := ParseRouteConfig([]byte(data), RouteConfigYAML)
+
+	var validationErr *RouteValidationError
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, []string{
+			`line 4: invalid path definition: '/api/transfers/{id' error: unclosed route parameter at index 15`,
+			`line 5: route has no methods`,
+			`line 6: path must start with '/': 'api/accounts'`,
+			`line 9: unknown route field: 'target'`,
+			`line 7: invalid method: 'get'`,
+			`line 10: unknown field: 'unknown'`,
+		}, validationErr.Problems)
+	}
+
+	// Items of block sequences are reported on their own line.
+	_, err = ParseRouteConfig([]byte("routes:\n  - path: /api/x\n    methods:\n      - GET\n      - post\n"), RouteConfigYAML)
+	assert.EqualError(t, err, `invalid route rules: line 5: invalid method: 'post'`)
+
+	_, err = ParseRouteConfig([]byte("{\n  \"routes\": [\n    {\"methods\": [\"GET\"],}\n  ]\n}"), RouteConfigJSON)
+	assert.EqualError(t, err, `line 3 column 26: unable to parse route config: invalid character '}' looking for beginning of object key string`)
+}
+
+func Test_Route_Config_Router_Errors(t *testing.T) {
+	config, err := ParseRouteConfig([]byte(`
+routes:
+  - methods: [GET]
+    path: /api/transfers/{id}
+    handler: missing
+  - methods: [GET]
+    path: /api/transfers/{guid}
+    auth: missing
+`), RouteConfigYAML)
+	assert.NoError(t, err)
+
+	_, err = config.Router(RouteHandlers{})
+
+	var validationErr *RouteValidationError
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, []string{
+			`line 5: unknown handler: 'missing'`,
+			`line 8: unknown auth: 'missing'`,
+			`line 7: path: '/api/transfers/{guid}' is shadowed by: '/api/transfers/{id}' for method: 'GET'`,
+		}, validationErr.Problems)
+	}
+}
+
+func Test_Load_Route_Config_File(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "routes.json")
+	assert.NoError(t, os.WriteFile(path, []byte(testRouteConfigJSON), 0600))
+
+	config, err := LoadRouteConfigFile(path)
+	if assert.NoError(t, err) {
+		assert.Len(t, config.Routes, 2)
+	}
+
+	_, err = LoadRouteConfigFile(filepath.Join(dir, "routes.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package gl_routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type routeMatchCtxKey struct{}
+
+// RouteMatch is the result of a successful Router lookup.
+//
+// Unlike RouteRule, which is shared by every request, each RouteMatch is created per request.
+// Therefore it is safe to read its route parameters from concurrently running handlers.
+type RouteMatch struct {
+	// Rule is the registered route rule which matched the request.
+	Rule *RouteRule
+	// Params contains route parameters extracted from curly bracket definitions as key: name, value: value pairs.
+	Params map[string]string
+}
+
+// Param returns value of the named route parameter or an empty string if it does not exist.
+func (m *RouteMatch) Param(name string) string {
+	if m == nil {
+		return ""
+	}
+	return m.Params[name]
+}
+
+// ParamInt returns value of the named route parameter as int.
+//
+// It returns error if the parameter does not exist or is not a valid integer.
+func (m *RouteMatch) ParamInt(name string) (int, error) {
+	if m == nil {
+		return 0, fmt.Errorf("route parameter does not exist: '%s'", name)
+	}
+	return paramInt(m.Params, name)
+}
+
+// ParamInt64 returns value of the named route parameter as int64.
+//
+// It returns error if the parameter does not exist or is not a valid integer.
+func (m *RouteMatch) ParamInt64(name string) (int64, error) {
+	if m == nil {
+		return 0, fmt.Errorf("route parameter does not exist: '%s'", name)
+	}
+	return paramInt64(m.Params, name)
+}
+
+func paramInt(params map[string]string, name string) (int, error) {
+	value, err := paramInt64(params, name)
+	return int(value), err
+}
+
+func paramInt64(params map[string]string, name string) (int64, error) {
+	value, ok := params[name]
+	if !ok {
+		return 0, fmt.Errorf("route parameter does not exist: '%s'", name)
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("route parameter '%s' is not an integer: '%s'", name, value)
+	}
+	return parsed, nil
+}
+
+// NewRouteMatchContext returns a copy of ctx which carries the input route match.
+func NewRouteMatchContext(ctx context.Context, match *RouteMatch) context.Context {
+	return context.WithValue(ctx, routeMatchCtxKey{}, match)
+}
+
+// RouteMatchFromContext returns the route match stored in ctx or nil if there is none.
+func RouteMatchFromContext(ctx context.Context) *RouteMatch {
+	match, _ := ctx.Value(routeMatchCtxKey{}).(*RouteMatch)
+	return match
+}
+
+// WithRouteMatch returns a shallow copy of r whose context carries the input route match.
+func WithRouteMatch(r *http.Request, match *RouteMatch) *http.Request {
+	return r.WithContext(NewRouteMatchContext(r.Context(), match))
+}
+
+// RouteParams returns route parameters of the request which were stored by WithRouteMatch.
+//
+// It returns nil if the request context does not carry a route match.
+func RouteParams(r *http.Request) map[string]string {
+	match := RouteMatchFromContext(r.Context())
+	if match == nil {
+		return nil
+	}
+	return match.Params
+}
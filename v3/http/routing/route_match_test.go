@@ -0,0 +1,47 @@
+package gl_routing
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Meant to be run with -race flag.
+func Test_Match_Parallel_Requests(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/Transfer/{guid}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			guid := fmt.Sprintf("guid-%d", index)
+
+			req := toHttpRequest(`GET`, `/Transfer/`+guid)
+			match := router.Match(req)
+			if !assert.NotNil(t, match) {
+				return
+			}
+
+			req = WithRouteMatch(req, match)
+			assert.Equal(t, guid, RouteParams(req)["guid"])
+			assert.Equal(t, guid, RouteMatchFromContext(req.Context()).Param("guid"))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_RouteParams_Without_Match(t *testing.T) {
+	req, err := http.NewRequest(`GET`, `/Transfer/abc`, nil)
+	assert.NoError(t, err)
+
+	assert.Nil(t, RouteParams(req))
+	assert.Nil(t, RouteMatchFromContext(req.Context()))
+	assert.Equal(t, "", RouteMatchFromContext(req.Context()).Param("guid"))
+}
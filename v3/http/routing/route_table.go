@@ -2,7 +2,10 @@ package gl_routing
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
+	"strings"
+	"time"
 )
 
 type RouteTable struct {
@@ -12,8 +15,13 @@ type RouteTable struct {
 // NewProxyRouteTable checks validity of input routeRules.
 //
 // Note that rules for paths with route parameters must be defined with curly brackets.
+// Constraints are supported as in RouteToRegExp.
 //
-// E.g: /Transfer/{guid}
+// E.g: /Transfer/{guid}, /Transfer/{id:int}
+//
+// Compiled expressions are anchored, therefore a rule must match the whole query stripped request path.
+//
+// Upstream URL overrides of the rules are validated as well.
 func NewProxyRouteTable(routeRules []*ProxyRouteRule) (*RouteTable, error) {
 	table := &RouteTable{
 		routeRules: routeRules,
@@ -22,13 +30,23 @@ func NewProxyRouteTable(routeRules []*ProxyRouteRule) (*RouteTable, error) {
 	for _, e := range table.routeRules {
 		regexConv, err := RouteToRegExp(e.path)
 		if err != nil {
-			return nil, fmt.Errorf("invalid path definition: '%s'", e.path)
+			return nil, fmt.Errorf("invalid path definition: '%s' error: %s", e.path, err.Error())
 		}
 
-		e.regexp, err = regexp.Compile(regexConv)
+		e.regexp, err = regexp.Compile("^" + regexConv + "$")
 		if err != nil {
 			return nil, fmt.Errorf("can not compile: '%s': %s", e.path, err.Error())
 		}
+
+		if e.upstream != "" {
+			e.upstreamUrl, err = url.Parse(e.upstream)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse upstream URL: '%s' of path: '%s' error: %s", e.upstream, e.path, err.Error())
+			}
+			if e.upstreamUrl.Scheme == "" || e.upstreamUrl.Host == "" {
+				return nil, fmt.Errorf("upstream URL must be absolute: '%s' of path: '%s'", e.upstream, e.path)
+			}
+		}
 	}
 	return table, nil
 }
@@ -37,6 +55,15 @@ type ProxyRouteRule struct {
 	method string
 	path   string
 	regexp *regexp.Regexp
+
+	// Optional overrides of ProxyClient defaults.
+	upstream    string
+	upstreamUrl *url.URL
+	rewriteFrom string
+	rewriteTo   string
+	timeout     time.Duration
+	rateLimit   RateLimit
+	cacheTTL    time.Duration
 }
 
 // NewProxyRouteRule creates a single entry for RouteTable.
@@ -51,6 +78,48 @@ func NewProxyRouteRule(method, path string) *ProxyRouteRule {
 	}
 }
 
+// WithUpstream makes requests matching the rule go to input base URL instead of the default URL of ProxyClient.
+func (rr *ProxyRouteRule) WithUpstream(baseUrl string) *ProxyRouteRule {
+	rr.upstream = baseUrl
+	return rr
+}
+
+// WithStripPrefix removes input prefix from the request path before it is forwarded.
+//
+// E.g.: Prefix `/payments` forwards `/payments/123` as `/123`.
+func (rr *ProxyRouteRule) WithStripPrefix(prefix string) *ProxyRouteRule {
+	return rr.WithPathRewrite(prefix, "")
+}
+
+// WithPathRewrite replaces prefix from of the request path with to before it is forwarded.
+//
+// E.g.: From `/payments` to `/api/v2/payments` forwards `/payments/123` as `/api/v2/payments/123`.
+func (rr *ProxyRouteRule) WithPathRewrite(from, to string) *ProxyRouteRule {
+	rr.rewriteFrom = from
+	rr.rewriteTo = to
+	return rr
+}
+
+// WithTimeout overrides the timeout of http client of ProxyClient for requests matching the rule.
+func (rr *ProxyRouteRule) WithTimeout(timeout time.Duration) *ProxyRouteRule {
+	rr.timeout = timeout
+	return rr
+}
+
+// WithRateLimit overrides the default limit of the rate limiter of ProxyClient for requests matching the rule.
+// Route limits are tracked separately from the default limit.
+func (rr *ProxyRouteRule) WithRateLimit(limit RateLimit) *ProxyRouteRule {
+	rr.rateLimit = limit
+	return rr
+}
+
+// WithCacheTTL overrides the freshness lifetime of cached responses for GET requests matching the rule.
+// A negative TTL disables caching for the rule. See ProxyClient.SetCache.
+func (rr *ProxyRouteRule) WithCacheTTL(ttl time.Duration) *ProxyRouteRule {
+	rr.cacheTTL = ttl
+	return rr
+}
+
 func (rr *ProxyRouteRule) Method() string {
 	return rr.method
 }
@@ -62,3 +131,52 @@ func (rr *ProxyRouteRule) Path() string {
 func (rr *ProxyRouteRule) Regexp() regexp.Regexp {
 	return *rr.regexp
 }
+
+// Upstream returns the base URL override of the rule. Empty if there is none.
+func (rr *ProxyRouteRule) Upstream() string {
+	return rr.upstream
+}
+
+// Timeout returns the timeout override of the rule. Zero if there is none.
+func (rr *ProxyRouteRule) Timeout() time.Duration {
+	return rr.timeout
+}
+
+// RateLimit returns the rate limit override of the rule. Zero if there is none.
+func (rr *ProxyRouteRule) RateLimit() RateLimit {
+	return rr.rateLimit
+}
+
+// CacheTTL returns the cache TTL override of the rule. Zero if there is none.
+func (rr *ProxyRouteRule) CacheTTL() time.Duration {
+	return rr.cacheTTL
+}
+
+// rewritePath applies path rewrite of the rule to input path.
+//
+// The prefix is replaced only if it ends on a path segment boundary, e.g. `/api` does not rewrite `/apiary`.
+func (rr *ProxyRouteRule) rewritePath(path string) string {
+	return replacePathPrefix(path, rr.rewriteFrom, rr.rewriteTo)
+}
+
+// rewriteRawPath applies path rewrite of the rule to input escaped path.
+func (rr *ProxyRouteRule) rewriteRawPath(rawPath string) string {
+	return replacePathPrefix(rawPath, escapeSegments(rr.rewriteFrom), escapeSegments(rr.rewriteTo))
+}
+
+func replacePathPrefix(path, from, to string) string {
+	if from == "" || !strings.HasPrefix(path, from) {
+		return path
+	}
+
+	rest := strings.TrimPrefix(path, from)
+	if rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasSuffix(from, "/") {
+		return path
+	}
+
+	rewritten := to + rest
+	if !strings.HasPrefix(rewritten, "/") {
+		rewritten = "/" + rewritten
+	}
+	return rewritten
+}
@@ -0,0 +1,136 @@
+package gl_routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Route_Rule_Upstreams(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + r.URL.RequestURI()))
+		}))
+	}
+
+	payments := newUpstream("payments")
+	defer payments.Close()
+	accounts := newUpstream("accounts")
+	defer accounts.Close()
+	fallback := newUpstream("default")
+	defer fallback.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/payments/{id}`).WithUpstream(payments.URL).WithPathRewrite("/payments", "/api/v2/payments"),
+		NewProxyRouteRule(`GET`, `/accounts`).WithUpstream(accounts.URL + "/base").WithStripPrefix("/accounts"),
+		NewProxyRouteRule(`GET`, `/transfers`),
+		NewProxyRouteRule(`GET`, `/slow`).WithUpstream(slow.URL).WithTimeout(20 * time.Millisecond),
+	}, fallback.URL, nil)
+
+	type testData struct {
+		path       string
+		statusCode int
+		body       string
+	}
+
+	data := []testData{
+		{path: `/payments/123?x=1`, statusCode: http.StatusOK, body: `payments:/api/v2/payments/123?x=1`},
+		{path: `/accounts`, statusCode: http.StatusOK, body: `accounts:/base/`},
+		{path: `/transfers`, statusCode: http.StatusOK, body: `default:/transfers`},
+		{path: `/slow`, statusCode: http.StatusGatewayTimeout, body: `{"message":"gateway timeout","sessionId":"`},
+	}
+
+	for _, td := range data {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, td.path, nil))
+
+		assert.Equal(t, td.statusCode, rec.Code, td.path)
+		if td.statusCode >= http.StatusBadRequest {
+			// Error bodies end with a random session ID.
+			assert.True(t, strings.HasPrefix(rec.Body.String(), td.body), td.path)
+		} else {
+			assert.Equal(t, td.body, rec.Body.String(), td.path)
+		}
+	}
+}
+
+func Test_Proxy_Route_Table_Brace_Paths(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	var errs []error
+	pc := newTestProxyClient(t, []*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/{id}`),
+		NewProxyRouteRule(`GET`, `/static/{path...}`),
+	}, upstream.URL, func(err error, sessionID string) {
+		errs = append(errs, err)
+	})
+
+	type testData struct {
+		path       string
+		statusCode int
+	}
+
+	// Curly brackets of request paths are client input, not route parameter definitions.
+	data := []testData{
+		{path: `/api/{x}`, statusCode: http.StatusOK},
+		{path: `/api/{x`, statusCode: http.StatusOK},
+		{path: `/api/x}`, statusCode: http.StatusOK},
+		{path: `/static/a{b`, statusCode: http.StatusOK},
+		{path: `/other/{x}`, statusCode: http.StatusUnauthorized},
+	}
+
+	for _, td := range data {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, td.path, nil))
+		assert.Equal(t, td.statusCode, rec.Code, td.path)
+
+		// Request URI is not escaped if the request target is kept opaque.
+		req := httptest.NewRequest(`GET`, td.path, nil)
+		req.URL.Opaque = td.path
+		rec = httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+		assert.Equal(t, td.statusCode, rec.Code, td.path)
+	}
+
+	if assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "path is not allowed: /other/%7Bx%7D")
+		assert.EqualError(t, errs[1], "path is not allowed: /other/{x}")
+	}
+}
+
+func Test_Proxy_Route_Rule_Path_Rewrite(t *testing.T) {
+	rule := NewProxyRouteRule(`GET`, `/api/{path...}`).WithPathRewrite("/api", "/v2")
+	assert.Equal(t, "/v2/x", rule.rewritePath("/api/x"))
+	assert.Equal(t, "/v2", rule.rewritePath("/api"))
+	// Prefix must end on a path segment boundary.
+	assert.Equal(t, "/apiary/x", rule.rewritePath("/apiary/x"))
+
+	rule = NewProxyRouteRule(`GET`, `/my files/{path...}`).WithPathRewrite("/my files", "/shared docs")
+	assert.Equal(t, "/shared docs/a/b", rule.rewritePath("/my files/a/b"))
+	assert.Equal(t, "/shared%20docs/a%2Fb", rule.rewriteRawPath("/my%20files/a%2Fb"))
+
+	rule = NewProxyRouteRule(`GET`, `/accounts`).WithStripPrefix("/accounts")
+	assert.Equal(t, "/", rule.rewritePath("/accounts"))
+}
+
+func Test_Proxy_Route_Rule_Invalid_Upstream(t *testing.T) {
+	_, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/payments`).WithUpstream("payments.internal"),
+	})
+	assert.EqualError(t, err, `upstream URL must be absolute: 'payments.internal' of path: '/payments'`)
+}
@@ -0,0 +1,185 @@
+package gl_routing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RouteValidationError aggregates every problem found while validating route rules.
+type RouteValidationError struct {
+	Problems []string
+}
+
+func (e *RouteValidationError) Error() string {
+	return fmt.Sprintf("invalid route rules: %s", strings.Join(e.Problems, "; "))
+}
+
+// routeEntry is a validated route rule with its parsed path.
+type routeEntry struct {
+	rule     *RouteRule
+	tokens   []routeToken
+	segments []routeSegment
+}
+
+// routeSegment is a single slash separated piece of a route path.
+type routeSegment struct {
+	kind nodeKind
+	// Static segments: segment text. Param segments: constraint regex, empty if there is none.
+	value string
+}
+
+// validate parses input rules and checks them against each other and the already registered rules.
+func (sr *Router) validate(routeRules []*RouteRule) ([]*routeEntry, error) {
+	problems := make([]string, 0)
+	entries := make([]*routeEntry, 0, len(routeRules))
+
+	for _, r := range routeRules {
+		entry, err := newRouteEntry(r)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		if r.DynamicPath && !hasRouteParams(entry.tokens) {
+			problems = append(problems, fmt.Sprintf("path: '%s' has no route parameters but is registered as DynamicPath=true", r.Path))
+		}
+		if !r.DynamicPath && strings.ContainsAny(r.Path, "{}") {
+			problems = append(problems, fmt.Sprintf("path: '%s' has route parameters but is registered as DynamicPath=false", r.Path))
+		}
+
+		if r.Name != "" && sr.isNameTaken(r.Name, entries) {
+			problems = append(problems, fmt.Sprintf("route name: '%s' is registered multiple times", r.Name))
+		}
+
+		for _, existing := range append(sr.routes, entries...) {
+			if existing.rule.Method != r.Method {
+				continue
+			}
+
+			if existing.rule.Path == r.Path {
+				problems = append(problems, fmt.Sprintf("path: '%s' is registered multiple times to method: '%s'", r.Path, r.Method))
+				break
+			}
+
+			if existing.shadows(entry) {
+				problems = append(problems, fmt.Sprintf("path: '%s' is shadowed by: '%s' for method: '%s'", r.Path, existing.rule.Path, r.Method))
+				break
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(problems) > 0 {
+		return nil, &RouteValidationError{Problems: problems}
+	}
+	return entries, nil
+}
+
+func (sr *Router) isNameTaken(name string, pending []*routeEntry) bool {
+	if sr.namedRoutes[name] != nil {
+		return true
+	}
+	for _, e := range pending {
+		if e.rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func newRouteEntry(r *RouteRule) (*routeEntry, error) {
+	entry := &routeEntry{rule: r}
+
+	if !r.DynamicPath {
+		entry.tokens = []routeToken{{kind: staticNode, value: r.Path}}
+		entry.segments = toRouteSegments(entry.tokens)
+		return entry, nil
+	}
+
+	regexConv, err := RouteToRegExp(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path definition: '%s' error: %s", r.Path, err.Error())
+	}
+
+	_, err = regexp.Compile(regexConv)
+	if err != nil {
+		return nil, fmt.Errorf("unable parse dynamic path: '%s' error: %s", r.Path, err.Error())
+	}
+
+	entry.tokens, err = parseRouteExpression(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path definition: '%s' error: %s", r.Path, err.Error())
+	}
+	entry.segments = toRouteSegments(entry.tokens)
+	return entry, nil
+}
+
+func hasRouteParams(tokens []routeToken) bool {
+	for _, t := range tokens {
+		if t.kind != staticNode {
+			return true
+		}
+	}
+	return false
+}
+
+// toRouteSegments splits parsed route tokens into slash separated segments.
+func toRouteSegments(tokens []routeToken) []routeSegment {
+	// Route parameters always occupy a whole segment (see parseRouteExpression),
+	// so they are replaced with a placeholder before splitting.
+	const placeholder = "\x00"
+
+	path := strings.Builder{}
+	params := make([]routeToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.kind == staticNode {
+			path.WriteString(t.value)
+			continue
+		}
+		path.WriteString(placeholder)
+		params = append(params, t)
+	}
+
+	parts := strings.Split(path.String(), "/")
+	segments := make([]routeSegment, 0, len(parts))
+	for _, part := range parts {
+		if part != placeholder {
+			segments = append(segments, routeSegment{kind: staticNode, value: part})
+			continue
+		}
+		segments = append(segments, routeSegment{kind: params[0].kind, value: params[0].constraint})
+		params = params[1:]
+	}
+	return segments
+}
+
+// shadows returns true if every request which matches other is matched by e before other is considered.
+//
+// Static segments take priority during lookups, therefore only route parameters of e can shadow route parameters of other.
+// A route parameter without constraint shadows any route parameter, a constrained one only shadows the same constraint.
+func (e *routeEntry) shadows(other *routeEntry) bool {
+	if len(e.segments) != len(other.segments) {
+		return false
+	}
+
+	for i, s := range e.segments {
+		o := other.segments[i]
+		if s.kind != o.kind {
+			return false
+		}
+
+		switch s.kind {
+		case staticNode:
+			if s.value != o.value {
+				return false
+			}
+		case paramNode:
+			if s.value != "" && s.value != o.value {
+				return false
+			}
+		}
+	}
+	return true
+}
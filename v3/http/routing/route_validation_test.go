@@ -0,0 +1,64 @@
+package gl_routing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Route_Validation(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, DynamicPath: false},
+		{Method: `POST`, Path: `/api/accounts`, DynamicPath: false},
+		// Duplicate which is not adjacent to the first definition.
+		{Method: `GET`, Path: `/api/accounts`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{uniqueID}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{ref:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/reports`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/reports/{id}`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/invalid/{id`, DynamicPath: true},
+	}
+
+	_, err := NewRouter(routeRules)
+
+	var validationErr *RouteValidationError
+	if !assert.True(t, errors.As(err, &validationErr)) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		`path: '/api/accounts' is registered multiple times to method: 'GET'`,
+		`path: '/api/transfers/{uniqueID}' is shadowed by: '/api/transfers/{id}' for method: 'GET'`,
+		`path: '/api/transfers/{ref:int}' is shadowed by: '/api/transfers/{id}' for method: 'GET'`,
+		`path: '/api/reports' has no route parameters but is registered as DynamicPath=true`,
+		`path: '/api/reports/{id}' has route parameters but is registered as DynamicPath=false`,
+		`invalid path definition: '/api/invalid/{id' error: unclosed route parameter at index 13`,
+	}, validationErr.Problems)
+}
+
+func Test_Route_Validation_Valid_Overlaps(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/transfers/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{guid:uuid}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{slug}`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/transfers/{id}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/latest`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/transfers/{id}/items`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/{path...}`, DynamicPath: true},
+	}
+
+	_, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+}
+
+func Test_Route_Validation_On_Add(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/v1/transfers/{id}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	err = router.Group("/api/v1").Add(&RouteRule{Method: `GET`, Path: `/transfers/{guid}`, DynamicPath: true})
+	assert.EqualError(t, err, `invalid route rules: path: '/api/v1/transfers/{guid}' is shadowed by: '/api/v1/transfers/{id}' for method: 'GET'`)
+}
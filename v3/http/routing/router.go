@@ -1,61 +1,110 @@
 package gl_routing
 
 import (
-	"fmt"
 	"net/http"
-	"regexp"
 	"strings"
+
+	gl_http "github.com/payports/golib/v3/http"
 )
 
 type Router struct {
-	// Contains static path definitions in mapping as follows: QueryStrippedPath -> Method -> *RouteRule
-	staticPaths map[string]map[string]*RouteRule
-	// Contains dynamic path definitions which have named route parameters in them.
-	dynamicPaths []*RouteRule
-	// Contains all route rules as key: path, value: method pairs.
-	// Meant to be used for checking duplicates during initialization.
-	allPaths map[string]string
+	// Compressed prefix tree which holds both static and dynamic path definitions.
+	root *node
+	// Contains all registered route rules in registration order.
+	// Meant to be used for checking conflicts while registering new rules.
+	routes []*routeEntry
+	// Contains named route rules as key: name, value: route entry pairs.
+	namedRoutes map[string]*routeEntry
+
+	responseWriter          responseWriter
+	notFoundHandler         http.Handler
+	methodNotAllowedHandler http.Handler
+	onErr                   func(error, string)
+
+	// Global middlewares which wrap every request handled by ServeHTTP.
+	middlewares []Middleware
+	handler     http.Handler
 }
 
 // NewRouter creates http router from input routeRules.
 //
+// Route rules are stored in a compressed prefix tree, therefore lookups are bound to the length of the request path
+// rather than the number of registered rules.
+// When multiple rules can match the same request, static segments take priority over route parameters
+// and route parameters take priority over catch-all parameters.
+//
 // It will return error upon invalid data.
+// Duplicated, shadowed and misconfigured rules are reported together in a single *RouteValidationError.
 func NewRouter(routeRules []*RouteRule) (*Router, error) {
 	router := &Router{
-		staticPaths:  make(map[string]map[string]*RouteRule, len(routeRules)),
-		dynamicPaths: make([]*RouteRule, 0, len(routeRules)),
-		allPaths:     make(map[string]string, len(routeRules)),
+		root:           &node{kind: staticNode},
+		routes:         make([]*routeEntry, 0, len(routeRules)),
+		namedRoutes:    make(map[string]*routeEntry),
+		responseWriter: gl_http.NewResponseWriter(),
+	}
+
+	err := router.Add(routeRules...)
+	if err != nil {
+		return nil, err
 	}
+	return router, nil
+}
 
-	for _, r := range routeRules {
-		path, ok := router.allPaths[r.Path]
-		if ok && path == r.Method {
-			return nil, fmt.Errorf("path: '%s' is registered multiple times to method: '%s'", r.Path, r.Method)
+// Add registers additional route rules to the router.
+//
+// Input rules are validated against each other and the already registered rules before any of them is registered.
+// Every problem found is reported together in a single *RouteValidationError.
+//
+// It is not safe to call Add while the router is serving requests.
+func (sr *Router) Add(routeRules ...*RouteRule) error {
+	entries, err := sr.validate(routeRules)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if len(e.rule.Middlewares) > 0 {
+			e.rule.handler = chainMiddlewares(e.rule.Middlewares, http.HandlerFunc(sr.dispatch))
 		}
-		router.allPaths[r.Path] = r.Method
-
-		if !r.DynamicPath {
-			if router.staticPaths[r.Path] == nil {
-				router.staticPaths[r.Path] = make(map[string]*RouteRule)
-			}
-
-			router.staticPaths[r.Path][r.Method] = r
-		} else {
-			regexConv, err := RouteToRegExp(r.Path)
-			if err != nil {
-				return nil, fmt.Errorf("invalid path definition: '%s'", r.Path)
-			}
-
-			compiled, err := regexp.Compile(regexConv)
-			if err != nil {
-				return nil, fmt.Errorf("unable parse dynamic path: '%s' error: %s", r.Path, err.Error())
-			}
-			r.regex = compiled
-			router.dynamicPaths = append(router.dynamicPaths, r)
+
+		sr.root.insert(e.tokens, e.rule)
+		sr.routes = append(sr.routes, e)
+		if e.rule.Name != "" {
+			sr.namedRoutes[e.rule.Name] = e
 		}
+	}
+	return nil
+}
+
+// Match checks if incoming request matches with any of the routing rules.
+// It returns nil if there is no match.
+//
+// Route parameters are extracted from curly bracket definitions into the returned RouteMatch,
+// which is created per request and therefore safe for concurrent use.
+//
+// E.g: Input path: `/Transfer/{guid}`
+//
+// Request: `/Transfer/abcdef` will be returned as Params["guid"]="abcdef".
+// Route parameter values are unescaped, e.g. `/Transfer/a%20b` will be returned as Params["guid"]="a b".
+//
+// Use WithRouteMatch to make the result available to handlers through the request context.
+func (sr *Router) Match(r *http.Request) *RouteMatch {
+	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
 
+	params := make([]routeParam, 0, 4)
+	rule := sr.root.lookup(queryStrippedPath, r.Method, &params)
+	if rule == nil {
+		return nil
 	}
-	return router, nil
+
+	match := &RouteMatch{
+		Rule:   rule,
+		Params: make(map[string]string, len(params)),
+	}
+	for _, p := range params {
+		match.Params[p.name] = p.value
+	}
+	return match
 }
 
 // FindMatch can be used inside a http.Handle() to check if incoming request matches with any of the routing rules.
@@ -65,73 +114,45 @@ func NewRouter(routeRules []*RouteRule) (*Router, error) {
 // E.g: Input path: `/Transfer/{guid}`
 //
 // Request: `/Transfer/abcdef` will register as "guid"="abcdef" to routeParams.
+//
+// Deprecated: FindMatch stores route parameters in the shared RouteRule,
+// so concurrent requests to the same rule can read each other's parameters. Use Match instead.
 func (sr *Router) FindMatch(r *http.Request) *RouteRule {
-	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
-	staticPathRecord := sr.staticPaths[queryStrippedPath]
-	if staticPathRecord != nil {
-		staticRouteRule, ok := staticPathRecord[r.Method]
-		if ok {
-			return staticRouteRule
-		}
+	match := sr.Match(r)
+	if match == nil {
+		return nil
 	}
 
-	for _, v := range sr.dynamicPaths {
-		matchDynamicPath := v.regex.MatchString(queryStrippedPath)
-		if matchDynamicPath && v.Method == r.Method {
-			result := make(map[string]string)
-			match := v.regex.FindStringSubmatch(queryStrippedPath)
-			for i, name := range v.regex.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-
-			v.routeParams = result
-			return v
-		}
+	if match.Rule.DynamicPath {
+		match.Rule.routeParams = match.Params
 	}
-
-	return nil
+	return match.Rule
 }
 
 // HasMatch returns true if input request matches with any of the registered routed rules.
 func (sr *Router) HasMatch(r *http.Request) bool {
 	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
-	staticPathRecord := sr.staticPaths[queryStrippedPath]
-	if staticPathRecord != nil {
-		_, ok := staticPathRecord[r.Method]
-		if ok {
-			return true
-		}
-	}
 
-	for _, v := range sr.dynamicPaths {
-		matchDynamicPath := v.regex.MatchString(queryStrippedPath)
-		if matchDynamicPath && v.Method == r.Method {
-			result := make(map[string]string)
-			match := v.regex.FindStringSubmatch(queryStrippedPath)
-			for i, name := range v.regex.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-
-			return true
-		}
-	}
-
-	return false
+	params := make([]routeParam, 0, 4)
+	return sr.root.lookup(queryStrippedPath, r.Method, &params) != nil
 }
 
 // RouteRule is used for registering rules to Router.
 // Any request path with route parameters in it should be registered with within curly brackets.
 // They should also be registered as DynamicPath=true.
+// Each route parameter must occupy a whole path segment.
+// A trailing `{name...}` parameter matches the remainder of the path.
+//
+// Route parameters can be constrained as in RouteToRegExp, e.g. `{id:int}`, `{guid:uuid}` or `{slug:[a-z-]+}`.
+// Requests whose parameter values do not satisfy the constraint do not match the rule.
 //
-// Example path:  `/Transfer/{guid}`
+// Example paths:  `/Transfer/{guid}`, `/Transfer/{id:int}`, `/static/{path...}`
 //
 // Query parameters in a url are ignored during checking.
 // Therefore, request paths that have query parameters in it (but have no route parameters) should be registered as DynamicPath=false.
 type RouteRule struct {
+	// Name is optional. Named rules can be used for building URLs with Router.URL.
+	Name   string
 	Method string
 	Path   string
 	// DynamicPath should be set to true if endpoint has route parameters in it.
@@ -139,12 +160,25 @@ type RouteRule struct {
 	DynamicPath bool
 	AuthWith    func(sessionID string, w http.ResponseWriter, r *http.Request) error
 	RouteTo     func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string)
-
-	regex *regexp.Regexp
+	// Middlewares wrap AuthWith and RouteTo of this rule only.
+	// They run after global and route group middlewares.
+	Middlewares []Middleware
 
 	routeParams map[string]string
+	// Rule middlewares chained around Router.dispatch.
+	handler http.Handler
 }
 
+// ParamInt returns value of the named route parameter registered by the latest FindMatch call as int.
+//
+// Deprecated: Values are shared across concurrent requests. Use RouteMatch.ParamInt instead.
+func (r *RouteRule) ParamInt(name string) (int, error) {
+	return paramInt(r.routeParams, name)
+}
+
+// GetRouteParams returns route parameters registered by the latest FindMatch call.
+//
+// Deprecated: Values are shared across concurrent requests. Use RouteMatch.Params or RouteParams instead.
 func (r *RouteRule) GetRouteParams() map[string]string {
 	return r.routeParams
 }
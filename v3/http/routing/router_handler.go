@@ -0,0 +1,149 @@
+package gl_routing
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	gl_session "github.com/payports/golib/v3/session"
+)
+
+// ServeHTTP dispatches incoming request to the matching route rule.
+//
+// For every matched request a new session ID is generated, AuthWith is called (if defined)
+// and RouteTo is called once authentication succeeds.
+// Route parameters are passed to RouteTo and are also available via RouteParams(r).
+//
+// Requests which fail authentication are answered with 401.
+// Requests with no matching path are answered with 404,
+// requests whose path is registered only under other methods are answered with 405 and an Allow header.
+//
+// Global middlewares registered with Use wrap the whole dispatch,
+// middlewares of the matched rule wrap AuthWith and RouteTo.
+func (sr *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if sr.handler != nil {
+		sr.handler.ServeHTTP(w, r)
+		return
+	}
+	sr.serve(w, r)
+}
+
+func (sr *Router) serve(w http.ResponseWriter, r *http.Request) {
+	match := sr.Match(r)
+	if match == nil {
+		sr.handleNoMatch(w, r)
+		return
+	}
+
+	r = WithRouteMatch(r, match)
+	r = r.WithContext(gl_session.ContextWithID(r.Context(), gl_session.NewID()))
+
+	if match.Rule.handler != nil {
+		match.Rule.handler.ServeHTTP(w, r)
+		return
+	}
+	sr.dispatch(w, r)
+}
+
+// dispatch calls AuthWith and RouteTo of the matched rule stored in the request context.
+func (sr *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	match := RouteMatchFromContext(r.Context())
+	sessionID := SessionID(r)
+
+	if match.Rule.AuthWith != nil {
+		err := match.Rule.AuthWith(sessionID, w, r)
+		if err != nil {
+			if sr.onErr != nil {
+				sr.onErr(fmt.Errorf("authentication failed: %s", err.Error()), sessionID)
+			}
+			sr.writeMessage(w, http.StatusUnauthorized, "unauthorized call", sessionID)
+			return
+		}
+	}
+
+	if match.Rule.RouteTo == nil {
+		if sr.onErr != nil {
+			sr.onErr(fmt.Errorf("no RouteTo defined for path: '%s' method: '%s'", match.Rule.Path, match.Rule.Method), sessionID)
+		}
+		sr.writeMessage(w, http.StatusNotImplemented, "not implemented", sessionID)
+		return
+	}
+
+	match.Rule.RouteTo(w, r, sessionID, match.Params)
+}
+
+// SessionID returns the session ID which ServeHTTP generated for the request.
+//
+// It returns an empty string for requests which were not dispatched by a Router.
+// The session ID is carried by the request context, see gl_session.IDFromContext.
+func SessionID(r *http.Request) string {
+	return gl_session.IDFromContext(r.Context())
+}
+
+// SetNotFoundHandler replaces the default 404 response of ServeHTTP.
+func (sr *Router) SetNotFoundHandler(handler http.Handler) {
+	sr.notFoundHandler = handler
+}
+
+// SetMethodNotAllowedHandler replaces the default 405 response of ServeHTTP.
+//
+// Allow header is already set when the handler is called.
+func (sr *Router) SetMethodNotAllowedHandler(handler http.Handler) {
+	sr.methodNotAllowedHandler = handler
+}
+
+// SetResponseWriter replaces the gl_http.ResponseWriter used for writing default 401, 404 and 405 responses.
+func (sr *Router) SetResponseWriter(responseWriter responseWriter) {
+	sr.responseWriter = responseWriter
+}
+
+// SetOnErr registers a hook to receive errors which occur inside ServeHTTP.
+//
+// Hook will contain a second string value which represents session ID.
+func (sr *Router) SetOnErr(onErr func(error, string)) {
+	sr.onErr = onErr
+}
+
+// AllowedMethods returns sorted list of methods registered for the path of the input request.
+func (sr *Router) AllowedMethods(r *http.Request) []string {
+	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
+
+	methodSet := make(map[string]bool)
+	sr.root.collectMethods(queryStrippedPath, methodSet)
+
+	methods := make([]string, 0, len(methodSet))
+	for method := range methodSet {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (sr *Router) handleNoMatch(w http.ResponseWriter, r *http.Request) {
+	allowed := sr.AllowedMethods(r)
+	if len(allowed) == 0 {
+		if sr.notFoundHandler != nil {
+			sr.notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		sr.writeMessage(w, http.StatusNotFound, "not found", "")
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if sr.methodNotAllowedHandler != nil {
+		sr.methodNotAllowedHandler.ServeHTTP(w, r)
+		return
+	}
+	sr.writeMessage(w, http.StatusMethodNotAllowed, "method not allowed", "")
+}
+
+func (sr *Router) writeMessage(w http.ResponseWriter, statusCode int, message, sessionID string) {
+	_, err := sr.responseWriter.WriteCustomJsonResponse(w, statusCode, map[string]interface{}{
+		"message": message,
+	})
+	if err != nil && sr.onErr != nil {
+		sr.onErr(fmt.Errorf("write response error: %s", err.Error()), sessionID)
+	}
+}
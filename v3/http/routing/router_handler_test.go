@@ -0,0 +1,97 @@
+package gl_routing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Router_ServeHTTP(t *testing.T) {
+	authErr := errors.New("invalid token")
+
+	routeRules := []*RouteRule{
+		{
+			Method:      `GET`,
+			Path:        `/api/transfers/{guid}`,
+			DynamicPath: true,
+			RouteTo: func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+				assert.NotEmpty(t, sessionID)
+				assert.Equal(t, routeParams, RouteParams(r))
+				w.Write([]byte(routeParams["guid"]))
+			},
+		},
+		{
+			Method:      `DELETE`,
+			Path:        `/api/transfers/{guid}`,
+			DynamicPath: true,
+			AuthWith: func(sessionID string, w http.ResponseWriter, r *http.Request) error {
+				if r.Header.Get("Authorization") == "" {
+					return authErr
+				}
+				return nil
+			},
+			RouteTo: func(w http.ResponseWriter, r *http.Request, sessionID string, routeParams map[string]string) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	var errs []error
+	router.SetOnErr(func(err error, sessionID string) {
+		errs = append(errs, err)
+	})
+
+	type testData struct {
+		method     string
+		path       string
+		auth       string
+		statusCode int
+		body       string
+		allow      string
+	}
+
+	data := []testData{
+		{method: `GET`, path: `/api/transfers/abc`, statusCode: http.StatusOK, body: `abc`},
+		{method: `DELETE`, path: `/api/transfers/abc`, auth: `Bearer x`, statusCode: http.StatusNoContent},
+		{method: `DELETE`, path: `/api/transfers/abc`, statusCode: http.StatusUnauthorized, body: `{"message":"unauthorized call"}`},
+		{method: `POST`, path: `/api/transfers/abc`, statusCode: http.StatusMethodNotAllowed, body: `{"message":"method not allowed"}`, allow: `DELETE, GET`},
+		{method: `GET`, path: `/api/accounts`, statusCode: http.StatusNotFound, body: `{"message":"not found"}`},
+	}
+
+	for _, td := range data {
+		req := httptest.NewRequest(td.method, td.path, nil)
+		if td.auth != "" {
+			req.Header.Set("Authorization", td.auth)
+		}
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, td.statusCode, rec.Code, td.method+" "+td.path)
+		assert.Equal(t, td.body, rec.Body.String(), td.method+" "+td.path)
+		assert.Equal(t, td.allow, rec.Header().Get("Allow"), td.method+" "+td.path)
+	}
+
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "authentication failed: invalid token")
+	}
+}
+
+func Test_Router_Custom_NotFound(t *testing.T) {
+	router, err := NewRouter(nil)
+	assert.NoError(t, err)
+
+	router.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/missing`, nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
@@ -1,6 +1,7 @@
 package gl_routing
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -60,6 +61,171 @@ func Test_Route_Rules(t *testing.T) {
 
 }
 
+func Test_Route_Priority(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/transfers/latest`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{id}/items`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/{path...}`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/transfer`, DynamicPath: false},
+		{Method: `POST`, Path: `/api/{entity}`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	type testData struct {
+		fullPath       string
+		method         string
+		routeRuleIndex int
+		routeParams    map[string]string
+	}
+
+	data := []testData{
+		{fullPath: `/api/transfers/latest`, method: `GET`, routeRuleIndex: 0},
+		{fullPath: `/api/transfers/12345`, method: `GET`, routeRuleIndex: 1, routeParams: map[string]string{"id": "12345"}},
+		{fullPath: `/api/transfers/latest/items`, method: `GET`, routeRuleIndex: 2, routeParams: map[string]string{"id": "latest"}},
+		{fullPath: `/api/transfers/1/items/2`, method: `GET`, routeRuleIndex: 3, routeParams: map[string]string{"path": "transfers/1/items/2"}},
+		{fullPath: `/api/transfer?x=1`, method: `POST`, routeRuleIndex: 4},
+		{fullPath: `/api/transfers`, method: `POST`, routeRuleIndex: 5, routeParams: map[string]string{"entity": "transfers"}},
+	}
+
+	for _, td := range data {
+		foundRouteRule := router.FindMatch(toHttpRequest(td.method, td.fullPath))
+		if !assert.NotNil(t, foundRouteRule, td.fullPath) {
+			continue
+		}
+
+		assert.Equal(t, routeRules[td.routeRuleIndex], foundRouteRule, td.fullPath)
+		if td.routeParams != nil {
+			assert.Equal(t, td.routeParams, foundRouteRule.GetRouteParams(), td.fullPath)
+		}
+	}
+
+	assert.Nil(t, router.FindMatch(toHttpRequest(`GET`, `/other`)))
+	assert.Nil(t, router.FindMatch(toHttpRequest(`DELETE`, `/api/transfers/12345`)))
+	assert.False(t, router.HasMatch(toHttpRequest(`POST`, `/api/transfers/12345`)))
+}
+
+func Test_Route_Catch_All_Names(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/{path...}`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/{rest...}`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	match := router.Match(toHttpRequest(`GET`, `/api/a/b`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, routeRules[0], match.Rule)
+		assert.Equal(t, "a/b", match.Param("path"))
+		assert.Equal(t, "", match.Param("rest"))
+	}
+
+	match = router.Match(toHttpRequest(`POST`, `/api/a/b`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, routeRules[1], match.Rule)
+		assert.Equal(t, "a/b", match.Param("rest"))
+		assert.Equal(t, "", match.Param("path"))
+	}
+}
+
+func Test_Invalid_Route_Definitions(t *testing.T) {
+	paths := []string{
+		`/api/transfers/id-{id}`,
+		`/api/transfers/{id}-x`,
+		`/api/transfers/{id`,
+		`/api/{path...}/items`,
+		`/api/{}`,
+	}
+
+	for _, path := range paths {
+		_, err := NewRouter([]*RouteRule{{Method: `GET`, Path: path, DynamicPath: true}})
+		assert.Error(t, err, path)
+	}
+}
+
+func Test_Route_Constraints(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/entity/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/entity/{guid:uuid}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/blog/{slug:[a-z-]+}`, DynamicPath: true},
+		{Method: `GET`, Path: `/static/{path...}`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	match := router.Match(toHttpRequest(`GET`, `/api/entity/45`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, routeRules[0], match.Rule)
+		id, err := match.ParamInt("id")
+		assert.NoError(t, err)
+		assert.Equal(t, 45, id)
+
+		_, err = match.ParamInt("missing")
+		assert.Error(t, err)
+	}
+
+	match = router.Match(toHttpRequest(`GET`, `/api/entity/0f8fad5b-d9cb-469f-a165-70867728950e`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, routeRules[1], match.Rule)
+	}
+
+	match = router.Match(toHttpRequest(`GET`, `/api/blog/hello-world`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, "hello-world", match.Param("slug"))
+	}
+
+	match = router.Match(toHttpRequest(`GET`, `/static/css/site.css`))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, "css/site.css", match.Param("path"))
+	}
+
+	// Constraint failures and nested paths are non-matches.
+	assert.Nil(t, router.Match(toHttpRequest(`GET`, `/api/entity/abc`)))
+	assert.Nil(t, router.Match(toHttpRequest(`GET`, `/api/entity/1/reference/x`)))
+	assert.Nil(t, router.Match(toHttpRequest(`GET`, `/api/blog/Hello`)))
+}
+
+func Test_Proxy_Route_Table_Constraints(t *testing.T) {
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/entity/{id:int}`),
+	})
+	assert.NoError(t, err)
+
+	re := table.routeRules[0].Regexp()
+	assert.True(t, re.MatchString(`/api/entity/45`))
+	assert.False(t, re.MatchString(`/api/entity/abc`))
+	assert.False(t, re.MatchString(`/api/entity/1/reference/x`))
+	assert.False(t, re.MatchString(`/prefix/api/entity/1`))
+}
+
+func Benchmark_FindMatch(b *testing.B) {
+	routeRules := make([]*RouteRule, 0, 500)
+	for i := 0; i < 250; i++ {
+		routeRules = append(routeRules,
+			&RouteRule{Method: `GET`, Path: fmt.Sprintf(`/api/v1/service%d/transfers`, i), DynamicPath: false},
+			&RouteRule{Method: `GET`, Path: fmt.Sprintf(`/api/v1/service%d/transfers/{id}`, i), DynamicPath: true},
+		)
+	}
+
+	router, err := NewRouter(routeRules)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	req := toHttpRequest(`GET`, `/api/v1/service249/transfers/12345`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if router.FindMatch(req) == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
 func toHttpRequest(method, path string) *http.Request {
 	split := strings.Split(path, "?")
 	queryStrippedPath := split[0]
@@ -0,0 +1,326 @@
+package gl_routing
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type nodeKind uint8
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	catchAllNode
+)
+
+// node is a single entry of the compressed prefix tree used by Router.
+//
+// Static nodes hold a shared path prefix, param nodes match exactly one path segment
+// and catch-all nodes match the remainder of the path.
+// During lookups children are tried in priority order: static, param, catch-all.
+type node struct {
+	kind nodeKind
+	// Static nodes: shared path prefix. Param nodes: route parameter name.
+	label string
+
+	// First bytes of static children labels, index aligned with staticChildren.
+	indices        []byte
+	staticChildren []*node
+	// Param children are tried in registration order.
+	paramChildren []*node
+	catchAll      *node
+
+	// Param nodes only: segment values must match constraint if it is defined.
+	constraintExpr string
+	constraint     *regexp.Regexp
+
+	// Registered route rules which end on this node as key: method, value: route rule pairs.
+	rules map[string]*RouteRule
+	// Catch-all nodes only: route parameter name of each method, since rules of different methods
+	// share the node but can name the parameter differently.
+	catchAllNames map[string]string
+}
+
+// routeToken is a single piece of a parsed route expression.
+type routeToken struct {
+	kind  nodeKind
+	value string
+	// Regex constraint of route parameter tokens. Empty if there is none.
+	constraint string
+	// Anchored and compiled constraint, nil if there is none.
+	constraintRegexp *regexp.Regexp
+}
+
+// parseRouteExpression splits a route expression into static and route parameter tokens.
+//
+// Route parameters must occupy a whole path segment.
+// A catch-all parameter is marked with a trailing ellipsis and must be the last segment of the path.
+//
+// E.g.: `/api/transfers/{id:int}` and `/static/{path...}` are valid, `/api/transfers/id-{id}` is not.
+func parseRouteExpression(path string) ([]routeToken, error) {
+	tokens := make([]routeToken, 0, 4)
+	static := strings.Builder{}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '{' {
+			if path[i] == '}' {
+				return nil, fmt.Errorf("unexpected '}' at index %d", i)
+			}
+			static.WriteByte(path[i])
+			continue
+		}
+
+		if i > 0 && path[i-1] != '/' {
+			return nil, fmt.Errorf("route parameter at index %d must start a path segment", i)
+		}
+
+		end := findRouteParamEnd(path, i)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed route parameter at index %d", i)
+		}
+
+		def, err := parseRouteParamDef(path[i+1 : end])
+		if err != nil {
+			return nil, err
+		}
+
+		if def.catchAll && end+1 < len(path) {
+			return nil, fmt.Errorf("catch-all route parameter '%s' must be the last path segment", def.name)
+		}
+
+		if end+1 < len(path) && path[end+1] != '/' {
+			return nil, fmt.Errorf("route parameter '%s' must end a path segment", def.name)
+		}
+
+		if static.Len() > 0 {
+			tokens = append(tokens, routeToken{kind: staticNode, value: static.String()})
+			static.Reset()
+		}
+
+		token := routeToken{kind: paramNode, value: def.name}
+		if def.catchAll {
+			token.kind = catchAllNode
+		} else if def.constraint != "" {
+			token.constraint = def.regex()
+			// Constraint was already validated by parseRouteParamDef.
+			token.constraintRegexp = regexp.MustCompile(`^(?:` + token.constraint + `)$`)
+		}
+		tokens = append(tokens, token)
+		i = end
+	}
+
+	if static.Len() > 0 {
+		tokens = append(tokens, routeToken{kind: staticNode, value: static.String()})
+	}
+	return tokens, nil
+}
+
+func isRouteParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		isWordChar := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isWordChar {
+			return false
+		}
+	}
+	return true
+}
+
+// insert registers rule under the path described by tokens.
+func (n *node) insert(tokens []routeToken, rule *RouteRule) {
+	current := n
+	for _, t := range tokens {
+		switch t.kind {
+		case staticNode:
+			current = current.insertStatic(t.value)
+		case paramNode:
+			current = current.insertParam(t)
+		case catchAllNode:
+			current = current.insertCatchAll()
+			current.catchAllNames[rule.Method] = t.value
+		}
+	}
+
+	if current.rules == nil {
+		current.rules = make(map[string]*RouteRule)
+	}
+	current.rules[rule.Method] = rule
+}
+
+// insertStatic adds path to static children of n, splitting existing nodes on partially shared prefixes.
+// It returns the node on which path ends.
+func (n *node) insertStatic(path string) *node {
+	current := n
+	for path != "" {
+		child := current.staticChild(path[0])
+		if child == nil {
+			child = &node{kind: staticNode, label: path}
+			current.indices = append(current.indices, path[0])
+			current.staticChildren = append(current.staticChildren, child)
+			return child
+		}
+
+		shared := commonPrefixLen(child.label, path)
+		if shared < len(child.label) {
+			child.split(shared)
+		}
+
+		path = path[shared:]
+		current = child
+	}
+	return current
+}
+
+// split moves everything after label[:at] into a new child node.
+func (n *node) split(at int) {
+	tail := &node{
+		kind:           staticNode,
+		label:          n.label[at:],
+		indices:        n.indices,
+		staticChildren: n.staticChildren,
+		paramChildren:  n.paramChildren,
+		catchAll:       n.catchAll,
+		rules:          n.rules,
+	}
+
+	n.label = n.label[:at]
+	n.indices = []byte{tail.label[0]}
+	n.staticChildren = []*node{tail}
+	n.paramChildren = nil
+	n.catchAll = nil
+	n.rules = nil
+}
+
+func (n *node) insertParam(t routeToken) *node {
+	for _, child := range n.paramChildren {
+		if child.label == t.value && child.constraintExpr == t.constraint {
+			return child
+		}
+	}
+
+	child := &node{kind: paramNode, label: t.value, constraintExpr: t.constraint, constraint: t.constraintRegexp}
+	n.paramChildren = append(n.paramChildren, child)
+	return child
+}
+
+func (n *node) insertCatchAll() *node {
+	if n.catchAll == nil {
+		n.catchAll = &node{kind: catchAllNode, catchAllNames: make(map[string]string)}
+	}
+	return n.catchAll
+}
+
+func (n *node) staticChild(c byte) *node {
+	for i, index := range n.indices {
+		if index == c {
+			return n.staticChildren[i]
+		}
+	}
+	return nil
+}
+
+// lookup walks the tree for path and returns the first route rule registered for method.
+//
+// Matched route parameter values are appended to params.
+func (n *node) lookup(path, method string, params *[]routeParam) *RouteRule {
+	if path == "" {
+		return n.rules[method]
+	}
+
+	if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.label) {
+		if rule := child.lookup(path[len(child.label):], method, params); rule != nil {
+			return rule
+		}
+	}
+
+	if len(n.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+
+		// Path is matched in escaped form, route parameter values are unescaped before checking constraints.
+		value, err := url.PathUnescape(path[:end])
+		if end > 0 && err == nil {
+			for _, child := range n.paramChildren {
+				if child.constraint != nil && !child.constraint.MatchString(value) {
+					continue
+				}
+				*params = append(*params, routeParam{name: child.label, value: value})
+				if rule := child.lookup(path[end:], method, params); rule != nil {
+					return rule
+				}
+				*params = (*params)[:len(*params)-1]
+			}
+		}
+	}
+
+	if n.catchAll != nil {
+		value, err := url.PathUnescape(path)
+		if rule := n.catchAll.rules[method]; rule != nil && err == nil {
+			*params = append(*params, routeParam{name: n.catchAll.catchAllNames[method], value: value})
+			return rule
+		}
+	}
+
+	return nil
+}
+
+type routeParam struct {
+	name  string
+	value string
+}
+
+func commonPrefixLen(a, b string) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+
+	i := 0
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// collectMethods adds methods of every route rule whose path matches the input path to methods.
+func (n *node) collectMethods(path string, methods map[string]bool) {
+	if path == "" {
+		for method := range n.rules {
+			methods[method] = true
+		}
+		return
+	}
+
+	if child := n.staticChild(path[0]); child != nil && strings.HasPrefix(path, child.label) {
+		child.collectMethods(path[len(child.label):], methods)
+	}
+
+	if len(n.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+
+		value, err := url.PathUnescape(path[:end])
+		if end > 0 && err == nil {
+			for _, child := range n.paramChildren {
+				if child.constraint != nil && !child.constraint.MatchString(value) {
+					continue
+				}
+				child.collectMethods(path[end:], methods)
+			}
+		}
+	}
+
+	if n.catchAll != nil {
+		for method := range n.catchAll.rules {
+			methods[method] = true
+		}
+	}
+}
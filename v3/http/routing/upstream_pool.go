@@ -0,0 +1,346 @@
+package gl_routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type UpstreamStrategy int
+
+const (
+	// RoundRobin picks healthy targets in turn.
+	RoundRobin UpstreamStrategy = iota
+	// LeastConnections picks the healthy target with the fewest in-flight requests.
+	LeastConnections
+	// Weighted picks healthy targets in proportion to their weights (smooth weighted round robin).
+	Weighted
+)
+
+// UpstreamTarget is a single upstream server of UpstreamPool.
+type UpstreamTarget struct {
+	URL string
+	// Weight is only used by Weighted strategy. Values lower than 1 are treated as 1.
+	Weight int
+}
+
+// UpstreamPoolConfig defines load balancing and health check behavior of UpstreamPool.
+type UpstreamPoolConfig struct {
+	Strategy UpstreamStrategy
+
+	// HealthCheckPath enables active health checks when it is not empty.
+	// Targets are healthy while GET requests to the path return 2xx or 3xx.
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// MaxConsecutiveFailures enables passive ejection when it is greater than 0.
+	// Targets are marked unhealthy after the given number of consecutive connection errors or 502, 503, 504 responses.
+	MaxConsecutiveFailures int
+	// EjectionDuration is the time after which a passively ejected target is tried again.
+	// Only used when active health checks are disabled.
+	EjectionDuration time.Duration
+}
+
+// UpstreamHealthEvent is reported through onErr hook of ProxyClient whenever health state of a target changes.
+type UpstreamHealthEvent struct {
+	Target  string
+	Healthy bool
+	Reason  string
+}
+
+func (e *UpstreamHealthEvent) Error() string {
+	state := "unhealthy"
+	if e.Healthy {
+		state = "healthy"
+	}
+	return fmt.Sprintf("upstream: '%s' is %s: %s", e.Target, state, e.Reason)
+}
+
+// UpstreamStatus is a snapshot of a target's state.
+type UpstreamStatus struct {
+	Target              string
+	Healthy             bool
+	ActiveConnections   int64
+	ConsecutiveFailures int
+}
+
+// UpstreamPool distributes requests over a set of upstream targets.
+type UpstreamPool struct {
+	config  UpstreamPoolConfig
+	targets []*upstream
+
+	counter uint64
+	// Guards currentWeight of targets.
+	weightMu sync.Mutex
+
+	healthCli *http.Client
+
+	// Guards listeners, which are added while health checks may already be running.
+	listenersMu sync.Mutex
+	// Receive health state changes, one for every proxy client using the pool.
+	listeners []func(*UpstreamHealthEvent)
+}
+
+type upstream struct {
+	raw    string
+	url    *url.URL
+	weight int
+
+	active int64
+
+	mu                  sync.Mutex
+	healthy             bool
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	currentWeight       int
+}
+
+// NewUpstreamPool creates a pool from input targets. All targets start as healthy.
+//
+// It will return error upon invalid data.
+func NewUpstreamPool(targets []UpstreamTarget, config UpstreamPoolConfig) (*UpstreamPool, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("upstream pool requires at least one target")
+	}
+
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = 10 * time.Second
+	}
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = 2 * time.Second
+	}
+	if config.EjectionDuration <= 0 {
+		config.EjectionDuration = 30 * time.Second
+	}
+
+	pool := &UpstreamPool{
+		config:    config,
+		targets:   make([]*upstream, 0, len(targets)),
+		healthCli: &http.Client{Timeout: config.HealthCheckTimeout},
+	}
+
+	for _, t := range targets {
+		parsed, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse upstream URL: '%s' error: %s", t.URL, err.Error())
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("upstream URL must be absolute: '%s'", t.URL)
+		}
+
+		weight := t.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		pool.targets = append(pool.targets, &upstream{raw: t.URL, url: parsed, weight: weight, healthy: true})
+	}
+	return pool, nil
+}
+
+// StartHealthChecks runs active health checks in a separate goroutine until ctx is done.
+//
+// It does nothing if HealthCheckPath is not configured.
+func (p *UpstreamPool) StartHealthChecks(ctx context.Context) {
+	if p.config.HealthCheckPath == "" {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.config.HealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			p.checkAll(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Status returns a snapshot of every target's state.
+func (p *UpstreamPool) Status() []UpstreamStatus {
+	statuses := make([]UpstreamStatus, 0, len(p.targets))
+	for _, u := range p.targets {
+		u.mu.Lock()
+		statuses = append(statuses, UpstreamStatus{
+			Target:              u.raw,
+			Healthy:             u.healthy,
+			ActiveConnections:   atomic.LoadInt64(&u.active),
+			ConsecutiveFailures: u.consecutiveFailures,
+		})
+		u.mu.Unlock()
+	}
+	return statuses
+}
+
+// pick returns the next target according to the strategy or nil if there is no healthy target.
+func (p *UpstreamPool) pick() *upstream {
+	healthy := make([]*upstream, 0, len(p.targets))
+	for _, u := range p.targets {
+		if p.isAvailable(u) {
+			healthy = append(healthy, u)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	switch p.config.Strategy {
+	case LeastConnections:
+		// Start from a rotating offset, so that ties are spread across targets.
+		offset := int(atomic.AddUint64(&p.counter, 1) % uint64(len(healthy)))
+		picked := healthy[offset]
+		for i := 1; i < len(healthy); i++ {
+			u := healthy[(offset+i)%len(healthy)]
+			if atomic.LoadInt64(&u.active) < atomic.LoadInt64(&picked.active) {
+				picked = u
+			}
+		}
+		return picked
+	case Weighted:
+		p.weightMu.Lock()
+		defer p.weightMu.Unlock()
+
+		total := 0
+		var picked *upstream
+		for _, u := range healthy {
+			u.currentWeight += u.weight
+			total += u.weight
+			if picked == nil || u.currentWeight > picked.currentWeight {
+				picked = u
+			}
+		}
+		picked.currentWeight -= total
+		return picked
+	default:
+		return healthy[int((atomic.AddUint64(&p.counter, 1)-1)%uint64(len(healthy)))]
+	}
+}
+
+// isAvailable returns true if u is healthy or its passive ejection has expired.
+func (p *UpstreamPool) isAvailable(u *upstream) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.healthy {
+		return true
+	}
+	// Without active health checks, ejected targets are given another chance after EjectionDuration.
+	return p.config.HealthCheckPath == "" && !u.ejectedUntil.IsZero() && time.Now().After(u.ejectedUntil)
+}
+
+func (p *UpstreamPool) acquire(u *upstream) {
+	atomic.AddInt64(&u.active, 1)
+}
+
+func (p *UpstreamPool) release(u *upstream) {
+	atomic.AddInt64(&u.active, -1)
+}
+
+// reportResult updates passive health state of u with the outcome of a proxied request.
+func (p *UpstreamPool) reportResult(u *upstream, failure error) {
+	if p.config.MaxConsecutiveFailures <= 0 {
+		return
+	}
+
+	if failure == nil {
+		p.setHealthy(u, true, "request succeeded")
+		return
+	}
+
+	u.mu.Lock()
+	u.consecutiveFailures++
+	eject := u.consecutiveFailures >= p.config.MaxConsecutiveFailures
+	u.mu.Unlock()
+
+	if eject {
+		p.setHealthy(u, false, fmt.Sprintf("%d consecutive failures, last: %s", p.config.MaxConsecutiveFailures, failure.Error()))
+	}
+}
+
+func (p *UpstreamPool) setHealthy(u *upstream, healthy bool, reason string) {
+	u.mu.Lock()
+	changed := u.healthy != healthy
+	// Re-ejection of an expired target must be reported as well.
+	if !healthy && !u.ejectedUntil.IsZero() && time.Now().After(u.ejectedUntil) {
+		changed = true
+	}
+
+	u.healthy = healthy
+	if healthy {
+		u.consecutiveFailures = 0
+		u.ejectedUntil = time.Time{}
+	} else {
+		u.ejectedUntil = time.Now().Add(p.config.EjectionDuration)
+	}
+	u.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	p.listenersMu.Lock()
+	listeners := p.listeners
+	p.listenersMu.Unlock()
+
+	event := &UpstreamHealthEvent{Target: u.raw, Healthy: healthy, Reason: reason}
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// addListener registers fn to receive health state changes of the targets.
+func (p *UpstreamPool) addListener(fn func(*UpstreamHealthEvent)) {
+	p.listenersMu.Lock()
+	defer p.listenersMu.Unlock()
+
+	p.listeners = append(p.listeners, fn)
+}
+
+func (p *UpstreamPool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, u := range p.targets {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			err := p.check(ctx, u)
+			if err != nil {
+				p.setHealthy(u, false, err.Error())
+				return
+			}
+			p.setHealthy(u, true, "health check succeeded")
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (p *UpstreamPool) check(ctx context.Context, u *upstream) error {
+	checkUrl := strings.TrimSuffix(u.raw, "/") + p.config.HealthCheckPath
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkUrl, nil)
+	if err != nil {
+		return fmt.Errorf("could not create health check request: %s", err.Error())
+	}
+
+	res, err := p.healthCli.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %s", err.Error())
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("health check returned status: %d", res.StatusCode)
+	}
+	return nil
+}
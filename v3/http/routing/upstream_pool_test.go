@@ -0,0 +1,189 @@
+package gl_routing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gl_http "github.com/payports/golib/v3/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Upstream_Pool_Strategies(t *testing.T) {
+	targets := []UpstreamTarget{
+		{URL: "http://a.local", Weight: 3},
+		{URL: "http://b.local", Weight: 1},
+	}
+
+	roundRobin, err := NewUpstreamPool(targets, UpstreamPoolConfig{Strategy: RoundRobin})
+	assert.NoError(t, err)
+	picks := map[string]int{}
+	for i := 0; i < 8; i++ {
+		picks[roundRobin.pick().raw]++
+	}
+	assert.Equal(t, map[string]int{"http://a.local": 4, "http://b.local": 4}, picks)
+
+	weighted, err := NewUpstreamPool(targets, UpstreamPoolConfig{Strategy: Weighted})
+	assert.NoError(t, err)
+	picks = map[string]int{}
+	for i := 0; i < 8; i++ {
+		picks[weighted.pick().raw]++
+	}
+	assert.Equal(t, map[string]int{"http://a.local": 6, "http://b.local": 2}, picks)
+
+	leastConn, err := NewUpstreamPool(targets, UpstreamPoolConfig{Strategy: LeastConnections})
+	assert.NoError(t, err)
+	busy := leastConn.targets[0]
+	leastConn.acquire(busy)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "http://b.local", leastConn.pick().raw)
+	}
+	leastConn.release(busy)
+
+	_, err = NewUpstreamPool(nil, UpstreamPoolConfig{})
+	assert.Error(t, err)
+	_, err = NewUpstreamPool([]UpstreamTarget{{URL: "/relative"}}, UpstreamPoolConfig{})
+	assert.Error(t, err)
+}
+
+func Test_Upstream_Pool_Passive_Ejection(t *testing.T) {
+	var failingHits int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer working.Close()
+
+	pool, err := NewUpstreamPool([]UpstreamTarget{{URL: failing.URL}, {URL: working.URL}}, UpstreamPoolConfig{
+		Strategy:               RoundRobin,
+		MaxConsecutiveFailures: 2,
+		EjectionDuration:       time.Hour,
+	})
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var events []*UpstreamHealthEvent
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)})
+	assert.NoError(t, err)
+	pc := NewProxyClient(routeTable, "", http.DefaultClient, gl_http.NewResponseWriter(), nil, func(err error, sessionID string) {
+		if event, ok := err.(*UpstreamHealthEvent); ok {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		}
+	}, nil, nil)
+	pc.SetUpstreamPool(pool)
+
+	for i := 0; i < 10; i++ {
+		pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/accounts`, nil))
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failingHits))
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, failing.URL, events[0].Target)
+		assert.False(t, events[0].Healthy)
+	}
+
+	status := pool.Status()
+	assert.False(t, status[0].Healthy)
+	assert.True(t, status[1].Healthy)
+}
+
+func Test_Upstream_Pool_Active_Health_Checks(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	pool, err := NewUpstreamPool([]UpstreamTarget{{URL: server.URL}}, UpstreamPoolConfig{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: 5 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	events := make(chan *UpstreamHealthEvent, 10)
+	pool.addListener(func(event *UpstreamHealthEvent) {
+		events <- event
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.StartHealthChecks(ctx)
+
+	atomic.StoreInt32(&healthy, 0)
+	select {
+	case event := <-events:
+		assert.False(t, event.Healthy)
+	case <-time.After(time.Second):
+		t.Fatal("unhealthy target was not detected")
+	}
+	assert.Nil(t, pool.pick())
+
+	atomic.StoreInt32(&healthy, 1)
+	select {
+	case event := <-events:
+		assert.True(t, event.Healthy)
+	case <-time.After(time.Second):
+		t.Fatal("recovered target was not detected")
+	}
+	assert.NotNil(t, pool.pick())
+}
+
+func Test_Upstream_Pool_Shared_Events(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	pool, err := NewUpstreamPool([]UpstreamTarget{{URL: server.URL}}, UpstreamPoolConfig{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	// Health checks are already running while proxy clients attach the pool.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.StartHealthChecks(ctx)
+
+	routeTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)})
+	assert.NoError(t, err)
+
+	events := make([]chan *UpstreamHealthEvent, 2)
+	for i := range events {
+		received := make(chan *UpstreamHealthEvent, 10)
+		events[i] = received
+		pc := NewProxyClient(routeTable, "", http.DefaultClient, gl_http.NewResponseWriter(), nil, func(err error, sessionID string) {
+			if event, ok := err.(*UpstreamHealthEvent); ok {
+				received <- event
+			}
+		}, nil, nil)
+		pc.SetUpstreamPool(pool)
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	for _, received := range events {
+		select {
+		case event := <-received:
+			assert.False(t, event.Healthy)
+		case <-time.After(time.Second):
+			t.Fatal("unhealthy target was not reported to every proxy client")
+		}
+	}
+}
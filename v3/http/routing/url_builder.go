@@ -0,0 +1,61 @@
+package gl_routing
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URL builds the path of the named route rule by substituting its route parameters.
+//
+// Route parameter values are path escaped and must satisfy constraints of the rule.
+// Router.Match unescapes them again, so that built paths match with the same values.
+// Slashes are preserved in catch-all parameter values.
+// It returns error if the name is not registered or a route parameter is missing.
+//
+// Query is appended if it is not empty.
+//
+// E.g.: router.URL("transfer.get", map[string]string{"guid": id}, nil) can return `/Transfer/abcdef`
+// for a rule named "transfer.get" with path `/Transfer/{guid}`.
+func (sr *Router) URL(name string, params map[string]string, query url.Values) (string, error) {
+	entry := sr.namedRoutes[name]
+	if entry == nil {
+		return "", fmt.Errorf("route name is not registered: '%s'", name)
+	}
+
+	built := strings.Builder{}
+	for _, t := range entry.tokens {
+		if t.kind == staticNode {
+			built.WriteString(t.value)
+			continue
+		}
+
+		value, ok := params[t.value]
+		if !ok || value == "" {
+			return "", fmt.Errorf("missing route parameter: '%s' for route: '%s'", t.value, name)
+		}
+
+		if t.constraintRegexp != nil && !t.constraintRegexp.MatchString(value) {
+			return "", fmt.Errorf("route parameter: '%s' does not satisfy constraint: '%s' for route: '%s'", t.value, t.constraint, name)
+		}
+
+		if t.kind == catchAllNode {
+			built.WriteString(escapeSegments(value))
+		} else {
+			built.WriteString(url.PathEscape(value))
+		}
+	}
+
+	if len(query) > 0 {
+		built.WriteString("?" + query.Encode())
+	}
+	return built.String(), nil
+}
+
+func escapeSegments(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,78 @@
+package gl_routing
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Router_URL(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Name: "transfer.get", Method: `GET`, Path: `/api/transfers/{guid}`, DynamicPath: true},
+		{Name: "entity.reference", Method: `GET`, Path: `/api/entity/{id:int}/reference/{ref}`, DynamicPath: true},
+		{Name: "accounts", Method: `GET`, Path: `/api/accounts`},
+		{Name: "static", Method: `GET`, Path: `/static/{path...}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	type testData struct {
+		name   string
+		params map[string]string
+		query  url.Values
+		url    string
+		err    string
+	}
+
+	data := []testData{
+		{name: "transfer.get", params: map[string]string{"guid": "abc def/1"}, url: `/api/transfers/abc%20def%2F1`},
+		{name: "entity.reference", params: map[string]string{"id": "45", "ref": "xyz"}, url: `/api/entity/45/reference/xyz`},
+		{name: "accounts", query: url.Values{"page": {"2"}, "tag": {"a", "b"}}, url: `/api/accounts?page=2&tag=a&tag=b`},
+		{name: "static", params: map[string]string{"path": "css/site main.css"}, url: `/static/css/site%20main.css`},
+		{name: "transfer.get", err: `missing route parameter: 'guid' for route: 'transfer.get'`},
+		{name: "entity.reference", params: map[string]string{"id": "abc", "ref": "xyz"}, err: `route parameter: 'id' does not satisfy constraint: '[0-9]+' for route: 'entity.reference'`},
+		{name: "missing", err: `route name is not registered: 'missing'`},
+	}
+
+	for _, td := range data {
+		built, err := router.URL(td.name, td.params, td.query)
+		if td.err != "" {
+			assert.EqualError(t, err, td.err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, td.url, built)
+	}
+}
+
+func Test_Router_URL_Round_Trip(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Name: "user", Method: `GET`, Path: `/api/users/{name:[a-z ]+}`, DynamicPath: true},
+		{Name: "static", Method: `GET`, Path: `/static/{path...}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	params := []map[string]string{
+		{"name": "john doe"},
+		{"path": "css/site main.css"},
+	}
+	for i, name := range []string{"user", "static"} {
+		built, err := router.URL(name, params[i], nil)
+		assert.NoError(t, err)
+
+		match := router.Match(httptest.NewRequest(`GET`, built, nil))
+		if assert.NotNil(t, match, built) {
+			assert.Equal(t, params[i], match.Params, built)
+		}
+	}
+}
+
+func Test_Router_Duplicate_Route_Names(t *testing.T) {
+	_, err := NewRouter([]*RouteRule{
+		{Name: "transfers", Method: `GET`, Path: `/api/transfers`},
+		{Name: "transfers", Method: `POST`, Path: `/api/transfers`},
+	})
+	assert.EqualError(t, err, `invalid route rules: route name: 'transfers' is registered multiple times`)
+}
@@ -0,0 +1,269 @@
+package gl_http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Codec marshals request bodies and unmarshals response bodies of WebRequestClient.
+type Codec interface {
+	// ContentType is set as the Content-Type header of requests with a marshaled body. It is not set if it is empty.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec marshals bodies with encoding/json.
+var JSONCodec Codec = NewCodec("application/json", json.Marshal, json.Unmarshal)
+
+type funcCodec struct {
+	contentType   string
+	marshalFunc   func(v interface{}) ([]byte, error)
+	unmarshalFunc func(data []byte, v interface{}) error
+}
+
+// NewCodec creates a codec from a marshal and unmarshal function pair, e.g. xml.Marshal and xml.Unmarshal.
+func NewCodec(contentType string, marshalFunc func(v interface{}) ([]byte, error), unmarshalFunc func(data []byte, v interface{}) error) Codec {
+	return &funcCodec{contentType: contentType, marshalFunc: marshalFunc, unmarshalFunc: unmarshalFunc}
+}
+
+func (c *funcCodec) ContentType() string {
+	return c.contentType
+}
+
+func (c *funcCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.marshalFunc(v)
+}
+
+func (c *funcCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.unmarshalFunc(data, v)
+}
+
+// Request is an outgoing request of WebRequestClient, created with WebRequestClient.NewRequest.
+//
+// Request is built with chained calls and sent with Do:
+//
+//	req := client.NewRequest("GET", "https://api.example.com/banks/{code}/branches").
+//		WithPathParam("code", "0062").
+//		WithQuery("city", "Istanbul", "Ankara").
+//		WithHeader("Accept-Language", "tr", "en")
+//	res, err := gl_http.Do[[]Branch](ctx, req)
+type Request struct {
+	client     *WebRequestClient
+	method     string
+	uri        string
+	pathParams map[string]string
+	query      url.Values
+	header     http.Header
+
+	body    interface{}
+	rawBody []byte
+	hasBody bool
+	codec   Codec
+
+	// Receives unmarshaled bodies of non-2xx responses, nil if they are not unmarshaled.
+	errorBody  interface{}
+	errorCodec Codec
+}
+
+// NewRequest creates a request which is sent with the http client and codec of w.
+//
+// uri can contain path parameters in curly brackets, e.g. /transfers/{id}, which are set with WithPathParam.
+func (w *WebRequestClient) NewRequest(method, uri string) *Request {
+	return &Request{
+		client:     w,
+		method:     method,
+		uri:        uri,
+		pathParams: make(map[string]string),
+		query:      url.Values{},
+		header:     http.Header{},
+		codec:      w.codec,
+	}
+}
+
+// WithPathParam replaces {name} in the URI of the request with the escaped value.
+// Once a path param is set, every path param of the URI must be set, otherwise Do returns error.
+func (r *Request) WithPathParam(name, value string) *Request {
+	r.pathParams[name] = value
+	return r
+}
+
+// WithQuery adds values of the query parameter. Values of repeated calls are appended.
+func (r *Request) WithQuery(name string, values ...string) *Request {
+	for _, v := range values {
+		r.query.Add(name, v)
+	}
+	return r
+}
+
+// WithHeader adds values of the header. Values of repeated calls are appended.
+func (r *Request) WithHeader(name string, values ...string) *Request {
+	for _, v := range values {
+		r.header.Add(name, v)
+	}
+	return r
+}
+
+// WithBody sets a payload which is marshaled with the codec of the request.
+func (r *Request) WithBody(body interface{}) *Request {
+	r.body = body
+	r.rawBody = nil
+	r.hasBody = body != nil
+	return r
+}
+
+// WithRawBody sets an already serialized payload, which is sent as it is. A nil payload is sent as an empty body.
+func (r *Request) WithRawBody(body []byte) *Request {
+	r.body = nil
+	r.rawBody = body
+	r.hasBody = true
+	return r
+}
+
+// WithCodec overrides the codec of the client for the request.
+func (r *Request) WithCodec(codec Codec) *Request {
+	r.codec = codec
+	return r
+}
+
+// WithErrorBody makes Do unmarshal bodies of non-2xx responses into v with the error codec of the request.
+// v is left unchanged if the body is empty or can not be unmarshaled, see HTTPError.DecodeErr.
+func (r *Request) WithErrorBody(v interface{}) *Request {
+	r.errorBody = v
+	return r
+}
+
+// WithErrorCodec sets the codec of error bodies, when they are encoded differently than successful responses.
+// The codec of the request is used by default.
+func (r *Request) WithErrorCodec(codec Codec) *Request {
+	r.errorCodec = codec
+	return r
+}
+
+// newHTTPError creates the error of a non-2xx response, unmarshaling its body into the error body of the request.
+func (r *Request) newHTTPError(res *http.Response, body []byte) *HTTPError {
+	httpErr := &HTTPError{StatusCode: res.StatusCode, Header: res.Header, Body: body}
+	if r.errorBody == nil || len(body) == 0 {
+		return httpErr
+	}
+
+	codec := r.errorCodec
+	if codec == nil {
+		codec = r.codec
+	}
+	httpErr.DecodeErr = codec.Unmarshal(body, r.errorBody)
+	return httpErr
+}
+
+// build creates the http request.
+func (r *Request) build(ctx context.Context) (*http.Request, error) {
+	uri, err := r.resolveURI()
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	contentType := ""
+	if r.hasBody && r.body == nil {
+		// Raw body, which is empty if it is nil.
+		body = bytes.NewReader(r.rawBody)
+	} else if r.hasBody {
+		reqAsBytes, err := r.codec.Marshal(r.body)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert request to byte array: %s", err.Error())
+		}
+		body = bytes.NewReader(reqAsBytes)
+		contentType = r.codec.ContentType()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, r.method, uri, body)
+	if err != nil {
+		return nil, fmt.Errorf("could not create new request: %s", err.Error())
+	}
+
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	for name, values := range r.header {
+		httpReq.Header[name] = append([]string(nil), values...)
+	}
+	return httpReq, nil
+}
+
+// resolveURI returns the URI of the request with path parameters and query.
+func (r *Request) resolveURI() (string, error) {
+	uri := r.uri
+	for name, value := range r.pathParams {
+		placeholder := "{" + name + "}"
+		if !strings.Contains(uri, placeholder) {
+			return "", fmt.Errorf("path param is not defined in uri: '%s'", name)
+		}
+		uri = strings.ReplaceAll(uri, placeholder, url.PathEscape(value))
+	}
+
+	// Escaped values can not contain curly brackets, remaining ones belong to path params which were not set.
+	// URIs without path params, e.g. of the map based methods, are sent as they are.
+	if len(r.pathParams) > 0 {
+		path := strings.SplitN(uri, "?", 2)[0]
+		if start := strings.Index(path, "{"); start >= 0 {
+			if end := strings.Index(path[start:], "}"); end >= 0 {
+				return "", fmt.Errorf("path param is not set: '%s'", path[start+1:start+end])
+			}
+		}
+	}
+
+	if len(r.query) == 0 {
+		return uri, nil
+	}
+	if strings.Contains(uri, "?") {
+		return uri + "&" + r.query.Encode(), nil
+	}
+	return uri + "?" + r.query.Encode(), nil
+}
+
+// Response is the result of a request sent with Do.
+type Response[T any] struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the raw response body.
+	Body []byte
+	// Data is the response body unmarshaled with the codec of the request.
+	// It is the zero value of T if the body is empty or the status code is not 2xx.
+	Data T
+}
+
+// Do sends req and unmarshals the body of 2xx responses into Data of the result.
+//
+// Empty bodies, e.g. of 204 responses, are not unmarshaled.
+// Responses with other status codes are returned along with *HTTPError, see Request.WithErrorBody.
+func Do[T any](ctx context.Context, req *Request) (Response[T], error) {
+	var res Response[T]
+
+	httpRes, body, err := req.client.execute(ctx, req)
+	if err != nil {
+		return res, err
+	}
+
+	res.StatusCode = httpRes.StatusCode
+	res.Header = httpRes.Header
+	res.Body = body
+
+	if !isSuccessStatus(res.StatusCode) {
+		return res, req.newHTTPError(httpRes, body)
+	}
+	if len(body) == 0 {
+		return res, nil
+	}
+
+	err = req.codec.Unmarshal(body, &res.Data)
+	if err != nil {
+		return res, fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
+	}
+	return res, nil
+}
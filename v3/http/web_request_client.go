@@ -1,264 +1,109 @@
 package gl_http
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
 )
 
 type WebRequestClient struct {
-	client        *http.Client
-	marshalFunc   func(v interface{}) ([]byte, error)
-	unmarshalFunc func(data []byte, v interface{}) error
+	client *http.Client
+	// Default codec of requests, built from marshalFunc and unmarshalFunc.
+	codec        Codec
+	retryPolicy  RetryPolicy
+	interceptors []Interceptor
+	// Interceptors composed around client.Do.
+	chain RoundTripFunc
 }
 
 // NewWebRequestClient creates a wrapper utility which handles http communication.
-func NewWebRequestClient(client *http.Client, marshalFunc func(v interface{}) ([]byte, error), unmarshalFunc func(data []byte, v interface{}) error) *WebRequestClient {
-	return &WebRequestClient{
-		client:        client,
-		marshalFunc:   marshalFunc,
-		unmarshalFunc: unmarshalFunc,
-	}
+//
+// Requests are created with NewRequest and sent with Do.
+// Requests are sent once unless a retry policy is set with WithRetryPolicy.
+// Cross-cutting behavior, e.g. authentication, can be added with WithInterceptors.
+//
+// Map based methods, e.g. Get and Post, unmarshal every non-empty response body into responseParser and return
+// the status code along with it. They only fail for non-2xx responses whose body can not be unmarshaled, with *HTTPError.
+// marshalFunc and unmarshalFunc are the default codec of requests, which does not set a Content-Type header.
+func NewWebRequestClient(client *http.Client, marshalFunc func(v interface{}) ([]byte, error), unmarshalFunc func(data []byte, v interface{}) error, opts ...WebRequestClientOption) *WebRequestClient {
+	w := &WebRequestClient{
+		client: client,
+		codec:  NewCodec("", marshalFunc, unmarshalFunc),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.buildChain()
+	return w
 }
 
 // Get sends a GET http request.
 func (w *WebRequestClient) Get(ctx context.Context, uri string, headers map[string]string, queryParams map[string]string, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
-	if queryParams != nil {
-		params := url.Values{}
-		for k, v := range queryParams {
-			params.Add(k, fmt.Sprint(v))
-		}
-		uri = uri + "?" + params.Encode()
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
-	if err != nil {
-		errStr := fmt.Errorf("could not create new request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	for k, v := range headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	httpRes, err := w.client.Do(httpReq)
-	if err != nil {
-		errStr := fmt.Errorf("error executing request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	defer httpRes.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		errStr := fmt.Errorf("could not read response body: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	err = w.unmarshalFunc(bodyBytes, responseParser)
-	if err != nil {
-		errStr := fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-	return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
+	return w.send(ctx, w.newLegacyRequest(http.MethodGet, uri, headers, queryParams), responseParser)
 }
 
 // Post sends a POST http request using a struct as payload.
 //
 // Use PostSerializedBody method if your payload input is string.
 func (w *WebRequestClient) Post(ctx context.Context, uri string, headers map[string]string, queryParams map[string]string, request, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
-	var reqAsBytes []byte
-
-	if request != nil {
-		reqAsBytes, err = w.marshalFunc(request)
-		if err != nil {
-			errStr := fmt.Errorf("could not convert request to byte array: %s", err.Error())
-			return nil, nil, 0, errStr
-		}
-	}
-
-	if queryParams != nil {
-		params := url.Values{}
-		for k, v := range queryParams {
-			params.Add(k, fmt.Sprint(v))
-		}
-		uri = uri + "?" + params.Encode()
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewBuffer(reqAsBytes))
-	if err != nil {
-		errStr := fmt.Errorf("could not create new request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	for k, v := range headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	httpRes, err := w.client.Do(httpReq)
-	if err != nil {
-		errStr := fmt.Errorf("error executing request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	defer httpRes.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		errStr := fmt.Errorf("could not read response body: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	err = w.unmarshalFunc(bodyBytes, responseParser)
-	if err != nil {
-		errStr := fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-	return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
+	return w.Do(ctx, http.MethodPost, uri, headers, queryParams, request, responseParser)
 }
 
 // PostSerializedBody sends a POST http request with a string payload.
 func (w *WebRequestClient) PostSerializedBody(ctx context.Context, uri string, headers map[string]string, queryParams map[string]string, request string, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
-	if queryParams != nil {
-		params := url.Values{}
-		for k, v := range queryParams {
-			params.Add(k, fmt.Sprint(v))
-		}
-		uri = uri + "?" + params.Encode()
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewBuffer([]byte(request)))
-	if err != nil {
-		errStr := fmt.Errorf("could not create new request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	for k, v := range headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	httpRes, err := w.client.Do(httpReq)
-	if err != nil {
-		errStr := fmt.Errorf("error executing request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	defer httpRes.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		errStr := fmt.Errorf("could not read response body: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	err = w.unmarshalFunc(bodyBytes, responseParser)
-	if err != nil {
-		errStr := fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-	return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
+	return w.DoSerializedBody(ctx, http.MethodPost, uri, headers, queryParams, request, responseParser)
 }
 
 // Do sends a http request using a struct as payload with given http verb.
 func (w *WebRequestClient) Do(ctx context.Context, method, uri string, headers map[string]string, queryParams map[string]string, request, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
-	var reqAsBytes []byte
-
-	if request != nil {
-		reqAsBytes, err = w.marshalFunc(request)
-		if err != nil {
-			errStr := fmt.Errorf("could not convert request to byte array: %s", err.Error())
-			return nil, nil, 0, errStr
-		}
-	}
-
-	if queryParams != nil {
-		params := url.Values{}
-		for k, v := range queryParams {
-			params.Add(k, fmt.Sprint(v))
-		}
-		uri = uri + "?" + params.Encode()
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewBuffer(reqAsBytes))
-	if err != nil {
-		errStr := fmt.Errorf("could not create new request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	for k, v := range headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	httpRes, err := w.client.Do(httpReq)
-	if err != nil {
-		errStr := fmt.Errorf("error executing request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	defer httpRes.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		errStr := fmt.Errorf("could not read response body: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-
-	err = w.unmarshalFunc(bodyBytes, responseParser)
-	if err != nil {
-		errStr := fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
-	return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
+	return w.send(ctx, w.newLegacyRequest(method, uri, headers, queryParams).WithBody(request), responseParser)
 }
 
+// CreateBasicAuthHeaderValue returns the Authorization header value of input credentials.
+//
+// Deprecated: Use BasicAuthInterceptor, which sets the header on every request.
 func (w *WebRequestClient) CreateBasicAuthHeaderValue(username, password string) string {
-	auth := username + ":" + password
-	encoded := base64.StdEncoding.EncodeToString([]byte(auth))
-	return "Basic " + encoded
+	return basicAuthHeaderValue(username, password)
 }
 
 // DoSerializedBody sends a http request with a string payload with given http verb.
 func (w *WebRequestClient) DoSerializedBody(ctx context.Context, method, uri string, headers map[string]string, queryParams map[string]string, request string, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
-	if queryParams != nil {
-		params := url.Values{}
-		for k, v := range queryParams {
-			params.Add(k, fmt.Sprint(v))
-		}
-		uri = uri + "?" + params.Encode()
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewBuffer([]byte(request)))
-	if err != nil {
-		errStr := fmt.Errorf("could not create new request: %s", err.Error())
-		return nil, nil, 0, errStr
-	}
+	return w.send(ctx, w.newLegacyRequest(method, uri, headers, queryParams).WithRawBody([]byte(request)), responseParser)
+}
 
+// newLegacyRequest creates a request from the arguments of the map based methods.
+func (w *WebRequestClient) newLegacyRequest(method, uri string, headers map[string]string, queryParams map[string]string) *Request {
+	req := w.NewRequest(method, uri)
 	for k, v := range headers {
-		httpReq.Header.Set(k, v)
+		req.WithHeader(k, v)
 	}
+	for k, v := range queryParams {
+		req.WithQuery(k, v)
+	}
+	return req
+}
 
-	httpRes, err := w.client.Do(httpReq)
+// send executes req and unmarshals the response body into responseParser, whatever the status code is.
+//
+// Empty bodies are not unmarshaled. If the body of a non-2xx response can not be unmarshaled,
+// *HTTPError is returned along with the response.
+func (w *WebRequestClient) send(ctx context.Context, req *Request, responseParser interface{}) (resHeaders http.Header, resBody []byte, statusCode int, err error) {
+	httpRes, bodyBytes, err := w.execute(ctx, req)
 	if err != nil {
-		errStr := fmt.Errorf("error executing request: %s", err.Error())
-		return nil, nil, 0, errStr
+		return nil, nil, 0, err
 	}
 
-	defer httpRes.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
-	if err != nil {
-		errStr := fmt.Errorf("could not read response body: %s", err.Error())
-		return nil, nil, 0, errStr
+	if len(bodyBytes) == 0 {
+		return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
 	}
 
-	err = w.unmarshalFunc(bodyBytes, responseParser)
+	err = req.codec.Unmarshal(bodyBytes, responseParser)
 	if err != nil {
+		if !isSuccessStatus(httpRes.StatusCode) {
+			return httpRes.Header, bodyBytes, httpRes.StatusCode, &HTTPError{StatusCode: httpRes.StatusCode, Header: httpRes.Header, Body: bodyBytes, DecodeErr: err}
+		}
 		errStr := fmt.Errorf("could not unmarshal response into input interface: %s", err.Error())
-		return nil, nil, 0, errStr
+		return httpRes.Header, bodyBytes, httpRes.StatusCode, errStr
 	}
 	return httpRes.Header, bodyBytes, httpRes.StatusCode, nil
 }
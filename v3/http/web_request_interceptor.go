@@ -0,0 +1,89 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	gl_session "github.com/payports/golib/v3/session"
+)
+
+// DefaultSessionIDHeader is the header which SessionIDInterceptor sets by default.
+const DefaultSessionIDHeader = "X-Session-ID"
+
+// RoundTripFunc sends a request and returns its response.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor is a middleware of outgoing requests of WebRequestClient.
+//
+// It can modify req before calling next and the response after next returns, or answer without calling next.
+// Interceptors are called for every attempt when requests are retried.
+type Interceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// TokenProvider provides access tokens for BearerTokenInterceptor.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenProviderFunc adapts a function to TokenProvider.
+type TokenProviderFunc func(ctx context.Context) (string, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// BearerTokenInterceptor sets 'Authorization: Bearer <token>' with a token of input provider.
+func BearerTokenInterceptor(provider TokenProvider) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		token, err := provider.Token(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("could not get bearer token: %s", err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return next(req)
+	}
+}
+
+// BasicAuthInterceptor sets the Authorization header with input credentials (RFC 7617).
+func BasicAuthInterceptor(username, password string) Interceptor {
+	headerValue := basicAuthHeaderValue(username, password)
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		req.Header.Set("Authorization", headerValue)
+		return next(req)
+	}
+}
+
+// SessionIDInterceptor propagates the session ID of the request context (see gl_session.ContextWithID)
+// in input header, DefaultSessionIDHeader if it is empty.
+// Requests which already have the header are not changed.
+func SessionIDInterceptor(header string) Interceptor {
+	if header == "" {
+		header = DefaultSessionIDHeader
+	}
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		sessionID := gl_session.IDFromContext(req.Context())
+		if sessionID != "" && req.Header.Get(header) == "" {
+			req.Header.Set(header, sessionID)
+		}
+		return next(req)
+	}
+}
+
+func basicAuthHeaderValue(username, password string) string {
+	auth := username + ":" + password
+	encoded := base64.StdEncoding.EncodeToString([]byte(auth))
+	return "Basic " + encoded
+}
+
+// buildChain composes interceptors around the http client, the first interceptor is the outermost one.
+func (w *WebRequestClient) buildChain() {
+	next := RoundTripFunc(w.client.Do)
+	for i := len(w.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := w.interceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, inner)
+		}
+	}
+	w.chain = next
+}
@@ -0,0 +1,85 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gl_session "github.com/payports/golib/v3/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Web_Request_Interceptors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+		w.Header().Set("X-Received-Session-ID", r.Header.Get(DefaultSessionIDHeader))
+		w.Header()["X-Order"] = r.Header.Values("X-Order")
+	}))
+	defer server.Close()
+
+	order := func(name string) Interceptor {
+		return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			req.Header.Add("X-Order", name)
+			res, err := next(req)
+			if err == nil {
+				res.Header.Add("X-Response-Order", name)
+			}
+			return res, err
+		}
+	}
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithInterceptors(
+		order("first"),
+		BearerTokenInterceptor(TokenProviderFunc(func(ctx context.Context) (string, error) {
+			return "token-1", nil
+		})),
+		SessionIDInterceptor(""),
+		order("second"),
+	))
+
+	ctx := gl_session.ContextWithID(context.Background(), "session-1")
+	res, err := Do[struct{}](ctx, client.NewRequest(http.MethodGet, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", res.Header.Get("X-Authorization"))
+	assert.Equal(t, "session-1", res.Header.Get("X-Received-Session-ID"))
+	assert.Equal(t, []string{"first", "second"}, res.Header.Values("X-Order"))
+	assert.Equal(t, []string{"second", "first"}, res.Header.Values("X-Response-Order"))
+
+	// Session ID of the request is not overridden.
+	res, err = Do[struct{}](ctx, client.NewRequest(http.MethodGet, server.URL).WithHeader(DefaultSessionIDHeader, "session-2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "session-2", res.Header.Get("X-Received-Session-ID"))
+
+	client = NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithInterceptors(BasicAuthInterceptor("user", "pass")))
+	res, err = Do[struct{}](context.Background(), client.NewRequest(http.MethodGet, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "Basic dXNlcjpwYXNz", res.Header.Get("X-Authorization"))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", client.CreateBasicAuthHeaderValue("user", "pass"))
+	assert.Equal(t, "", res.Header.Get("X-Received-Session-ID"))
+
+	client = NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithInterceptors(
+		BearerTokenInterceptor(TokenProviderFunc(func(ctx context.Context) (string, error) {
+			return "", errors.New("token endpoint is down")
+		})),
+	))
+	_, err = Do[struct{}](context.Background(), client.NewRequest(http.MethodGet, server.URL))
+	assert.EqualError(t, err, "error executing request: could not get bearer token: token endpoint is down")
+
+	// Interceptors can answer without sending the request.
+	client = NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithInterceptors(
+		func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		},
+	))
+	res, err = Do[struct{}](context.Background(), client.NewRequest(http.MethodGet, "http://unreachable.invalid"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,19 @@
+package gl_http
+
+// WebRequestClientOption configures a WebRequestClient created with NewWebRequestClient.
+type WebRequestClientOption func(w *WebRequestClient)
+
+// WithRetryPolicy enables retries of failed requests (see RetryPolicy).
+func WithRetryPolicy(policy RetryPolicy) WebRequestClientOption {
+	return func(w *WebRequestClient) {
+		w.retryPolicy = policy.withDefaults()
+	}
+}
+
+// WithInterceptors appends interceptors which see and modify every outgoing request and its response.
+// Interceptors are called in the order they are registered, the first one sees the request first.
+func WithInterceptors(interceptors ...Interceptor) WebRequestClientOption {
+	return func(w *WebRequestClient) {
+		w.interceptors = append(w.interceptors, interceptors...)
+	}
+}
@@ -0,0 +1,205 @@
+package gl_http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultIdempotencyKeyHeader is the header which makes requests with non-idempotent methods retryable.
+const DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy defines how WebRequestClient retries failed requests.
+//
+// Connection errors, attempt timeouts and 502, 503, 504 responses are retried.
+// Only idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT, DELETE) are retried,
+// other methods are retried only if the request has an idempotency key header.
+//
+// Retry-After headers of responses replace the backoff. Retries are given up when the wait is longer than MaxBackoff
+// or it would exceed the deadline of the request context.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one. Retries are disabled when it is lower than 2.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, 100ms by default. It doubles for every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts, 5s by default.
+	MaxBackoff time.Duration
+	// AttemptTimeout limits each attempt, including reading the response body.
+	// Attempts are derived from the request context, therefore its deadline limits the whole call.
+	AttemptTimeout time.Duration
+	// IdempotencyKeyHeader is the header which makes non-idempotent requests retryable, DefaultIdempotencyKeyHeader by default.
+	IdempotencyKeyHeader string
+}
+
+// idempotentMethods are the methods which can be sent more than once without changing the result (RFC 7231 section 4.2.2).
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if p.IdempotencyKeyHeader == "" {
+		p.IdempotencyKeyHeader = DefaultIdempotencyKeyHeader
+	}
+	return p
+}
+
+// maxAttempts returns the number of attempts allowed for req.
+func (p RetryPolicy) maxAttempts(req *http.Request) int {
+	if p.MaxAttempts < 2 {
+		return 1
+	}
+	if !IsIdempotentMethod(req.Method) && req.Header.Get(p.IdempotencyKeyHeader) == "" {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the wait before input retry.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	return Backoff(retry, p.InitialBackoff, p.MaxBackoff)
+}
+
+// Backoff returns the wait before input retry, which starts from initial and doubles for every further retry up to max.
+//
+// Equal jitter is applied, the result is between half of the wait and the wait itself,
+// so that clients which failed together do not retry together.
+func Backoff(retry int, initial, max time.Duration) time.Duration {
+	wait := initial
+	for i := 1; i < retry && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// IsIdempotentMethod reports whether requests with input method can be sent more than once without changing the result.
+func IsIdempotentMethod(method string) bool {
+	return idempotentMethods[method]
+}
+
+// execute sends req and reads the response body, retrying according to the retry policy of the client.
+func (w *WebRequestClient) execute(ctx context.Context, req *Request) (*http.Response, []byte, error) {
+	httpReq, err := req.build(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	policy := w.retryPolicy
+	attempts := policy.maxAttempts(httpReq)
+
+	for attempt := 1; ; attempt++ {
+		httpRes, body, err := w.attempt(ctx, httpReq, policy.AttemptTimeout)
+		if attempt >= attempts || !isRetryableResult(ctx, httpRes, err) {
+			return httpRes, body, err
+		}
+
+		wait := policy.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(httpRes); ok {
+			if retryAfter > policy.MaxBackoff {
+				return httpRes, body, err
+			}
+			wait = retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return httpRes, body, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, fmt.Errorf("error executing request: %s", ctx.Err().Error())
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a copy of httpReq with a rewound body and reads the response body within timeout.
+func (w *WebRequestClient) attempt(ctx context.Context, httpReq *http.Request, timeout time.Duration) (*http.Response, []byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	attemptReq := httpReq.Clone(ctx)
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not rewind request body: %s", err.Error())
+		}
+		attemptReq.Body = body
+	}
+
+	httpRes, err := w.chain(attemptReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error executing request: %s", err.Error())
+	}
+
+	defer httpRes.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read response body: %s", err.Error())
+	}
+	return httpRes, bodyBytes, nil
+}
+
+// isRetryableResult returns true for connection errors, attempt timeouts and 502, 503, 504 responses.
+// Errors caused by the request context are not retried.
+func isRetryableResult(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter returns the wait of the Retry-After header of res, either in seconds or as a HTTP date.
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Until(date)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
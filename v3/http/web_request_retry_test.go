@@ -0,0 +1,122 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFlakyServer fails the first failures requests with input status and echoes request bodies afterwards.
+func newFlakyServer(failures int32, status int, retryAfter string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(calls, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(body)
+	}))
+}
+
+func Test_Web_Request_Retry(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(2, http.StatusServiceUnavailable, "", &calls)
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}))
+
+	// Body is rewound for every attempt.
+	res, err := Do[testBranch](context.Background(), client.NewRequest(http.MethodPut, server.URL+"/branches").WithBody(testBranch{Code: "1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "1"}, res.Data)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Non-idempotent requests are sent once.
+	atomic.StoreInt32(&calls, 0)
+	res, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodPost, server.URL+"/branches").WithBody(testBranch{Code: "1"}))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	_, _, statusCode, err := client.Post(context.Background(), server.URL+"/branches", map[string]string{DefaultIdempotencyKeyHeader: "42"}, nil, testBranch{Code: "2"}, &testBranch{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func Test_Web_Request_Retry_After(t *testing.T) {
+	var calls int32
+	server := newFlakyServer(1, http.StatusServiceUnavailable, "0", &calls)
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     10 * time.Millisecond,
+	}))
+
+	// Retry-After replaces the backoff.
+	res, err := Do[testBranch](context.Background(), client.NewRequest(http.MethodGet, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Waits longer than MaxBackoff are not retried.
+	var slowCalls int32
+	slowServer := newFlakyServer(1, http.StatusServiceUnavailable, "60", &slowCalls)
+	defer slowServer.Close()
+
+	res, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodGet, slowServer.URL))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowCalls))
+}
+
+func Test_Web_Request_Retry_Attempt_Timeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"code":"1"}`))
+	}))
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	}))
+
+	res, err := Do[testBranch](context.Background(), client.NewRequest(http.MethodGet, server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "1"}, res.Data)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Retries do not outlive the request context.
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = Do[testBranch](ctx, client.NewRequest(http.MethodGet, server.URL))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
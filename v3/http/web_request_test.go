@@ -0,0 +1,181 @@
+package gl_http
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBranch struct {
+	Code string `json:"code" xml:"code"`
+	City string `json:"city" xml:"city"`
+}
+
+// newEchoServer responds with the received request, the body is returned as it is.
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Uri", r.RequestURI)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header()["X-Languages"] = r.Header.Values("Accept-Language")
+		w.Write(body)
+	}))
+}
+
+func Test_Web_Request_Do(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal)
+
+	req := client.NewRequest(http.MethodPost, server.URL+"/banks/{code}/branches").
+		WithPathParam("code", "00 62").
+		WithQuery("city", "Istanbul", "Ankara").
+		WithQuery("active", "true").
+		WithHeader("Accept-Language", "tr", "en").
+		WithCodec(JSONCodec).
+		WithBody(testBranch{Code: "1", City: "Istanbul"})
+
+	res, err := Do[testBranch](context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, testBranch{Code: "1", City: "Istanbul"}, res.Data)
+	assert.Equal(t, `{"code":"1","city":"Istanbul"}`, string(res.Body))
+	assert.Equal(t, "/banks/00%2062/branches?active=true&city=Istanbul&city=Ankara", res.Header.Get("X-Uri"))
+	assert.Equal(t, []string{"tr", "en"}, res.Header.Values("X-Languages"))
+	assert.Equal(t, "application/json", res.Header.Get("X-Content-Type"))
+
+	// Codecs decode responses as well.
+	req = client.NewRequest(http.MethodPut, server.URL+"/branches?code=1").
+		WithCodec(NewCodec("application/xml", xml.Marshal, xml.Unmarshal)).
+		WithBody(testBranch{Code: "1", City: "Ankara"})
+
+	res, err = Do[testBranch](context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "1", City: "Ankara"}, res.Data)
+	assert.Equal(t, "/branches?code=1", res.Header.Get("X-Uri"))
+	assert.Equal(t, "application/xml", res.Header.Get("X-Content-Type"))
+
+	// Nil raw bodies are sent empty.
+	res, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodPost, server.URL+"/branches").WithRawBody(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Body)
+	assert.Empty(t, res.Header.Get("X-Content-Type"))
+
+	_, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodGet, server.URL+"/banks").WithPathParam("code", "1"))
+	assert.EqualError(t, err, "path param is not defined in uri: 'code'")
+
+	_, err = Do[testBranch](context.Background(), client.NewRequest(http.MethodGet, server.URL+"/banks/{code}/branches/{id}").WithPathParam("id", "1"))
+	assert.EqualError(t, err, "path param is not set: 'code'")
+}
+
+func Test_Web_Request_Client_Legacy_Methods(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal)
+
+	var branch testBranch
+	resHeaders, resBody, statusCode, err := client.Post(context.Background(), server.URL+"/branches", map[string]string{"Accept-Language": "tr"}, map[string]string{"city": "Istanbul"}, testBranch{Code: "1"}, &branch)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, testBranch{Code: "1"}, branch)
+	assert.Equal(t, `{"code":"1","city":""}`, string(resBody))
+	assert.Equal(t, "POST", resHeaders.Get("X-Method"))
+	assert.Equal(t, "/branches?city=Istanbul", resHeaders.Get("X-Uri"))
+	assert.Equal(t, "tr", resHeaders.Get("X-Languages"))
+	// Legacy codec does not set a content type.
+	assert.Equal(t, "", resHeaders.Get("X-Content-Type"))
+
+	resHeaders, _, _, err = client.DoSerializedBody(context.Background(), http.MethodPatch, server.URL+"/branches", nil, nil, `{"code":"2"}`, &branch)
+	assert.NoError(t, err)
+	assert.Equal(t, testBranch{Code: "2"}, branch)
+	assert.Equal(t, "PATCH", resHeaders.Get("X-Method"))
+
+	// URIs of map based methods are sent as they are, curly brackets are not path params.
+	resHeaders, _, statusCode, err = client.Get(context.Background(), server.URL+"/branches/{literal}", nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "/branches/%7Bliteral%7D", resHeaders.Get("X-Uri"))
+
+	// Empty bodies are not unmarshaled.
+	_, _, statusCode, err = client.Get(context.Background(), server.URL+"/branches", nil, nil, &branch)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+}
+
+func Test_Web_Request_Error_Responses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deleted":
+			w.WriteHeader(http.StatusNoContent)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("<html>internal error</html>"))
+		case "/invalid":
+			w.Write([]byte("<html>ok</html>"))
+		default:
+			w.Header().Set("X-Error-Code", "E42")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"code":"E42","city":"unknown city"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewWebRequestClient(http.DefaultClient, json.Marshal, json.Unmarshal)
+	ctx := context.Background()
+
+	res, err := Do[testBranch](ctx, client.NewRequest(http.MethodDelete, server.URL+"/deleted"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, testBranch{}, res.Data)
+
+	var errBody testBranch
+	res, err = Do[testBranch](ctx, client.NewRequest(http.MethodPost, server.URL+"/branches").WithErrorBody(&errBody))
+	var httpErr *HTTPError
+	if assert.True(t, errors.As(err, &httpErr)) {
+		assert.Equal(t, http.StatusUnprocessableEntity, httpErr.StatusCode)
+		assert.Equal(t, "E42", httpErr.Header.Get("X-Error-Code"))
+		assert.NoError(t, httpErr.DecodeErr)
+		assert.EqualError(t, err, "unexpected response status: 422")
+	}
+	assert.Equal(t, testBranch{Code: "E42", City: "unknown city"}, errBody)
+	assert.Equal(t, testBranch{}, res.Data)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	res, err = Do[testBranch](ctx, client.NewRequest(http.MethodGet, server.URL+"/html").WithErrorBody(&errBody))
+	if assert.True(t, errors.As(err, &httpErr)) {
+		assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+		assert.Equal(t, []byte("<html>internal error</html>"), httpErr.Body)
+		assert.Error(t, httpErr.DecodeErr)
+	}
+
+	_, err = Do[testBranch](ctx, client.NewRequest(http.MethodGet, server.URL+"/invalid"))
+	assert.EqualError(t, err, "could not unmarshal response into input interface: invalid character '<' looking for beginning of value")
+
+	// Legacy methods keep unmarshaling error bodies and only fail if it is not possible.
+	var branch testBranch
+	_, _, statusCode, err := client.Get(ctx, server.URL+"/branches", nil, nil, &branch)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, "E42", branch.Code)
+
+	resHeaders, resBody, statusCode, err := client.Get(ctx, server.URL+"/html", nil, nil, &branch)
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+	assert.Equal(t, "text/html", resHeaders.Get("Content-Type"))
+	assert.Equal(t, "<html>internal error</html>", string(resBody))
+
+	_, _, statusCode, err = client.Do(ctx, http.MethodDelete, server.URL+"/deleted", nil, nil, nil, &branch)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, statusCode)
+}
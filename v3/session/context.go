@@ -0,0 +1,16 @@
+package gl_session
+
+import "context"
+
+type idCtxKey struct{}
+
+// ContextWithID returns a copy of ctx which carries input session ID.
+func ContextWithID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, idCtxKey{}, sessionID)
+}
+
+// IDFromContext returns the session ID carried by ctx, empty if there is none.
+func IDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(idCtxKey{}).(string)
+	return sessionID
+}
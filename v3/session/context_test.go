@@ -0,0 +1,17 @@
+package gl_session
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_Context_With_ID(t *testing.T) {
+	if IDFromContext(context.Background()) != "" {
+		t.Fatalf("unexpected session ID in empty context")
+	}
+
+	ctx := ContextWithID(context.Background(), "session-1")
+	if sessionID := IDFromContext(ctx); sessionID != "session-1" {
+		t.Fatalf("unexpected session ID: %s", sessionID)
+	}
+}